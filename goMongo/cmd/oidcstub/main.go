@@ -0,0 +1,267 @@
+// Command oidcstub is a minimal OpenID Connect provider for trying out and
+// testing OIDC login locally. It approves every authorization request
+// without asking, as the user given by the flags or the login_hint
+// parameter. Never expose it anywhere.
+//
+// Run it next to the server:
+//
+//	go run ./cmd/oidcstub -addr :9000 -email jane@example.com
+//
+// and configure the server with
+//
+//	OIDC_PROVIDERS=stub
+//	OIDC_STUB_ISSUER=http://localhost:9000
+//	OIDC_STUB_CLIENT_ID=go-mongo-events
+//	OIDC_STUB_CLIENT_SECRET=stub-secret
+//	OIDC_STUB_REDIRECT_URL=http://localhost:3000/login/oidc/stub/callback
+//
+// then open http://localhost:3000/login/oidc/stub in a browser or follow
+// the redirects with curl -L.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	addr          = flag.String("addr", ":9000", "address to listen on")
+	issuer        = flag.String("issuer", "http://localhost:9000", "issuer URL, as the server reaches it")
+	clientID      = flag.String("client-id", "go-mongo-events", "the only client ID accepted")
+	clientSecret  = flag.String("client-secret", "stub-secret", "its secret, empty for a public client")
+	subject       = flag.String("subject", "", "subject of the user, derived from the email when empty")
+	email         = flag.String("email", "jane@example.com", "email address of the user")
+	name          = flag.String("name", "Jane Doe", "name of the user")
+	emailVerified = flag.Bool("email-verified", true, "whether the email address counts as verified")
+)
+
+const keyID = "stub"
+
+// grant is an authorization code waiting to be exchanged.
+type grant struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	subject       string
+	email         string
+	expiresAt     time.Time
+}
+
+type provider struct {
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+func main() {
+	flag.Parse()
+
+	p, err := newProvider()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Stub OIDC provider for %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, p.handler()))
+}
+
+func newProvider() (*provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &provider{key: key, grants: map[string]grant{}}, nil
+}
+
+func (p *provider) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	return mux
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                *issuer,
+		"authorization_endpoint":                *issuer + "/authorize",
+		"token_endpoint":                        *issuer + "/token",
+		"jwks_uri":                              *issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize approves the request right away and redirects back with a code.
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != *clientID || redirectURI == "" {
+		http.Error(w, "unknown client or missing redirect_uri", http.StatusBadRequest)
+		return
+	}
+	callback, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "malformed redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	// From here on errors go back to the client, as in a real provider
+	values := callback.Query()
+	values.Set("state", query.Get("state"))
+	switch {
+	case query.Get("response_type") != "code":
+		values.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		values.Set("error", "invalid_request")
+		values.Set("error_description", "PKCE with S256 is required")
+	default:
+		userEmail := *email
+		if hint := query.Get("login_hint"); hint != "" {
+			userEmail = hint
+		}
+		userSubject := *subject
+		if userSubject == "" {
+			sum := sha256.Sum256([]byte(userEmail))
+			userSubject = hex.EncodeToString(sum[:8])
+		}
+
+		code := randomString()
+		p.mu.Lock()
+		p.grants[code] = grant{
+			redirectURI:   redirectURI,
+			codeChallenge: query.Get("code_challenge"),
+			nonce:         query.Get("nonce"),
+			subject:       userSubject,
+			email:         userEmail,
+			expiresAt:     time.Now().Add(time.Minute),
+		}
+		p.mu.Unlock()
+		values.Set("code", code)
+	}
+
+	callback.RawQuery = values.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token, checking the client and the PKCE
+// verifier.
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != *clientID || subtle.ConstantTimeCompare([]byte(secret), []byte(*clientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	// Codes are single use, whether the exchange succeeds or not
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g, ok := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+	if !ok || time.Now().After(g.expiresAt) || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		tokenError(w, "invalid_grant", "code_verifier doesn't match the code_challenge")
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            *issuer,
+		"sub":            g.subject,
+		"aud":            *clientID,
+		"azp":            *clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.email,
+		"email_verified": *emailVerified,
+		"name":           *name,
+	})
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
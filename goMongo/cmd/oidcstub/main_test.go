@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"example.com/goMongo/utils"
+)
+
+// startStub runs the stub provider and returns a client configured for it.
+func startStub(t *testing.T) *utils.OIDCProvider {
+	t.Helper()
+	p, err := newProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(p.handler())
+	t.Cleanup(server.Close)
+
+	*issuer = server.URL
+	return &utils.OIDCProvider{
+		Name:         "stub",
+		Issuer:       server.URL,
+		ClientID:     *clientID,
+		ClientSecret: *clientSecret,
+		RedirectURL:  "http://localhost:3000/login/oidc/stub/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+// authorize follows the authorization URL to the provider and returns the
+// query it redirects back with.
+func authorize(t *testing.T, authorizationURL string) url.Values {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	location, err := response.Location()
+	if err != nil {
+		t.Fatalf("authorize didn't redirect: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), "http://localhost:3000/login/oidc/stub/callback?") {
+		t.Fatalf("redirected to %s", location)
+	}
+	return location.Query()
+}
+
+func TestLoginAgainstStub(t *testing.T) {
+	savedEmail, savedVerified := *email, *emailVerified
+	defer func() { *email, *emailVerified = savedEmail, savedVerified }()
+
+	tests := []struct {
+		name          string
+		hint          string // login_hint sent to the provider
+		emailVerified bool
+		verifier      func(string) string // Code verifier sent with the exchange
+		nonce         func(string) string // Nonce the ID token is checked against
+		exchangeFails bool
+		verifyFails   bool
+		wantEmail     string
+	}{
+		{name: "verified email", emailVerified: true, wantEmail: "jane@example.com"},
+		{name: "unverified email", emailVerified: false, wantEmail: "jane@example.com"},
+		{name: "login hint", hint: "ada@example.com", emailVerified: true, wantEmail: "ada@example.com"},
+		{name: "wrong code verifier", emailVerified: true, verifier: func(string) string { return "guessed" }, exchangeFails: true},
+		{name: "wrong nonce", emailVerified: true, nonce: func(string) string { return "replayed" }, verifyFails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := startStub(t)
+			*email, *emailVerified = "jane@example.com", test.emailVerified
+
+			verifier, challenge, err := utils.NewPKCE()
+			if err != nil {
+				t.Fatal(err)
+			}
+			authorizationURL, err := provider.AuthorizationURL("state", "nonce", challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.hint != "" {
+				authorizationURL += "&login_hint=" + url.QueryEscape(test.hint)
+			}
+
+			callback := authorize(t, authorizationURL)
+			if callback.Get("state") != "state" || callback.Get("code") == "" {
+				t.Fatalf("callback query = %v", callback)
+			}
+
+			if test.verifier != nil {
+				verifier = test.verifier(verifier)
+			}
+			idToken, err := provider.Exchange(callback.Get("code"), verifier)
+			if test.exchangeFails {
+				if err == nil {
+					t.Error("Exchange succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Codes are single use
+			if _, err := provider.Exchange(callback.Get("code"), verifier); err == nil {
+				t.Error("a code was exchanged twice")
+			}
+
+			nonce := "nonce"
+			if test.nonce != nil {
+				nonce = test.nonce(nonce)
+			}
+			claims, err := provider.VerifyIDToken(idToken, nonce)
+			if test.verifyFails {
+				if err == nil {
+					t.Error("VerifyIDToken succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Email != test.wantEmail || claims.EmailVerified != test.emailVerified || claims.Subject == "" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequiresPKCE(t *testing.T) {
+	provider := startStub(t)
+	authorizationURL, err := provider.AuthorizationURL("state", "nonce", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := authorize(t, authorizationURL)
+	if callback.Get("error") != "invalid_request" || callback.Get("code") != "" {
+		t.Errorf("callback query = %v, want invalid_request", callback)
+	}
+}
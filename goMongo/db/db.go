@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 
+	"example.com/goMongo/config"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -12,10 +14,14 @@ import (
 var client *mongo.Client
 var database *mongo.Database
 
-// InitDB initializes the database connection
+// Whether the server supports transactions, see WithTransaction
+var transactions bool
+
+// InitDB initializes the database connection to MONGODB_URI and selects the
+// MONGODB_DATABASE database
 func InitDB() {
 	var err error
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
+	clientOptions := options.Client().ApplyURI(config.String("MONGODB_URI", "mongodb://localhost:27017"))
 
 	// Connect to MongoDB
 	client, err = mongo.Connect(context.TODO(), clientOptions)
@@ -29,8 +35,33 @@ func InitDB() {
 	}
 
 	// Get a handle for your database
-	database = client.Database("api_db")
+	database = client.Database(config.String("MONGODB_DATABASE", "api_db"))
 	fmt.Println("Connected to MongoDB!")
+
+	transactions = supportsTransactions(context.TODO())
+	if !transactions {
+		log.Println("MongoDB is a standalone server without transactions, multi-document writes run one after another. Use a replica set in production.")
+	}
+}
+
+// supportsTransactions reports whether the server is part of a replica set
+// or a sharded cluster. Standalone servers reject transactions.
+func supportsTransactions(ctx context.Context) bool {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	admin := client.Database("admin")
+	err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		// Servers before 4.4.2 only know the legacy name
+		err = admin.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello)
+	}
+	if err != nil {
+		log.Println("Failed to detect the MongoDB topology:", err)
+		return false
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid"
 }
 
 // GetDatabase returns the database handle
@@ -40,3 +71,34 @@ func GetDatabase() *mongo.Database {
 	}
 	return database
 }
+
+// GetClient returns the MongoDB client handle
+func GetClient() *mongo.Client {
+	if client == nil {
+		InitDB()
+	}
+	return client
+}
+
+// WithTransaction runs fn in a multi-document transaction, retrying it on
+// transient errors. Values of ctx stay visible to fn.
+//
+// MongoDB only supports transactions on replica sets and sharded clusters.
+// On a standalone server fn runs once without a transaction, so its writes
+// happen one after another and aren't rolled back when a later one fails.
+func WithTransaction(ctx context.Context, fn func(ctx mongo.SessionContext) error) error {
+	session, err := GetClient().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	if !transactions {
+		return mongo.WithSession(ctx, session, fn)
+	}
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
@@ -1,14 +1,71 @@
 package main
 
 import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata" // Embed the IANA time zone database for event time zones
+
+	"example.com/goMongo/config"
 	"example.com/goMongo/db"
+	"example.com/goMongo/models"
 	"example.com/goMongo/routes"
+	"example.com/goMongo/utils"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatal("Failed to load signing keys:", err)
+	}
+	reloadSigningKeysOnHangup()
+	if err := utils.LoadSecrets(); err != nil {
+		log.Fatal("Failed to load secrets:", err)
+	}
+	if err := utils.LoadPasswordHashers(); err != nil {
+		log.Fatal("Failed to configure password hashing:", err)
+	}
+	if err := utils.LoadPasswordDenyList(); err != nil {
+		log.Fatal("Failed to load the password deny list:", err)
+	}
+
 	db.InitDB()
+	if err := models.EnsureIndexes(); err != nil {
+		log.Fatal("Failed to create indexes:", err)
+	}
+	models.StartEventScheduler(time.Minute)
+	models.StartOrphanRepair(time.Hour)
+	models.StartSeriesMaterializer(
+		config.Duration("SERIES_MATERIALIZE_INTERVAL", time.Hour),
+		config.Duration("SERIES_MATERIALIZE_WINDOW", 90*24*time.Hour),
+	)
+	models.StartPurgeJob(
+		config.Duration("PURGE_INTERVAL", time.Hour),
+		config.Duration("PURGE_RETENTION", 30*24*time.Hour),
+	)
+	// Instances behind a load balancer have to share their rate limits
+	if config.String("RATE_LIMIT_STORE", "memory") == "mongo" {
+		utils.SetLimiterStore(models.MongoLimiterStore{})
+	}
 	server := gin.Default()
 	routes.RegisterRoutes(server)
 	server.Run(":3000")
 }
+
+// reloadSigningKeysOnHangup reloads the JWT keys when the process receives
+// SIGHUP, which is how key rotations take effect without a restart.
+func reloadSigningKeysOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := utils.LoadSigningKeys(); err != nil {
+				log.Println("Failed to reload signing keys, keeping the old ones:", err)
+				continue
+			}
+			log.Println("Reloaded signing keys")
+		}
+	}()
+}
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"example.com/goMongo/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin only lets administrators through. It has to run after
+// Authenticate, which puts the user ID in the context.
+func RequireAdmin(context *gin.Context) {
+	userId := context.GetString("userId")
+	if userId == "" {
+		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+		return
+	}
+
+	user, err := models.GetUserById(userId)
+	if err != nil || user == nil || user.Role != models.RoleAdmin {
+		context.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Admin access required"})
+		return
+	}
+
+	context.Next()
+}
@@ -0,0 +1,73 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"example.com/goMongo/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Header machine clients send their API key in
+const apiKeyHeader = "X-API-Key"
+
+// routeScopes lists the routes API keys may call and the scope each needs,
+// by method and route path. Everything else, such as managing keys, MFA or
+// the account itself, needs a login.
+var routeScopes = map[string]string{
+	"GET /getUser":           models.ScopeProfileRead,
+	"GET /users/me/calendar": models.ScopeProfileRead,
+
+	"GET /events":              models.ScopeEventsRead,
+	"GET /events/:id":          models.ScopeEventsRead,
+	"POST /events":             models.ScopeEventsWrite,
+	"PUT /events/:id":          models.ScopeEventsWrite,
+	"DELETE /events/:id":       models.ScopeEventsWrite,
+	"POST /events/:id/publish": models.ScopeEventsWrite,
+	"POST /events/:id/cancel":  models.ScopeEventsWrite,
+
+	"GET /events/registered":                models.ScopeRegistrationsRead,
+	"GET /events/:id/registrations":         models.ScopeRegistrationsRead,
+	"GET /registrations/:id/ticket":         models.ScopeRegistrationsRead,
+	"POST /events/:id/register":             models.ScopeRegistrationsWrite,
+	"DELETE /events/:id/cancelRegistration": models.ScopeRegistrationsWrite,
+	"POST /events/:id/checkin":              models.ScopeCheckIn,
+
+	"POST /venues":       models.ScopeVenuesWrite,
+	"PUT /venues/:id":    models.ScopeVenuesWrite,
+	"DELETE /venues/:id": models.ScopeVenuesWrite,
+
+	"POST /series":                models.ScopeSeriesWrite,
+	"PUT /series/:id":             models.ScopeSeriesWrite,
+	"POST /series/:id/exceptions": models.ScopeSeriesWrite,
+}
+
+// authenticateAPIKey authenticates a request by its API key, and only lets
+// it through when the key has the scope the route needs.
+func authenticateAPIKey(context *gin.Context, key string) {
+	apiKey, err := models.AuthenticateAPIKey(key)
+	if err == models.ErrInvalidAPIKey {
+		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		context.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "unable to check API key"})
+		fmt.Println(err)
+		return
+	}
+
+	scope, ok := routeScopes[context.Request.Method+" "+context.FullPath()]
+	if !ok {
+		context.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "API keys can't be used for this endpoint"})
+		return
+	}
+	if !apiKey.HasScope(scope) {
+		context.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "API key lacks the " + scope + " scope"})
+		return
+	}
+
+	context.Set("userId", apiKey.UserID.Hex())
+	context.Set("apiKeyId", apiKey.ID.Hex())
+
+	context.Next()
+}
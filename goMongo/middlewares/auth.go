@@ -1,29 +1,84 @@
 package middlewares
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
+	"example.com/goMongo/models"
 	"example.com/goMongo/utils"
 	"github.com/gin-gonic/gin"
 )
 
+// bearerToken extracts the token from an Authorization header. Both the
+// standard "Bearer <token>" form and a bare token are accepted.
+func bearerToken(header string) string {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return strings.TrimSpace(header)
+}
+
+// Authenticate requires a valid token, or an API key in the X-API-Key
+// header with the scope the route needs.
 func Authenticate(context *gin.Context) {
+	if key := context.GetHeader(apiKeyHeader); key != "" {
+		authenticateAPIKey(context, key)
+		return
+	}
+
 	// Get the token from the request header
-	token := context.Request.Header.Get("Authorization")
+	token := bearerToken(context.Request.Header.Get("Authorization"))
 	if token == "" {
 		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Token is required"})
 		return
 	}
 
 	// Verify the token and extract the user ID
-	userId, err := utils.VerifyToken(token)
+	userId, sessionId, err := utils.VerifyToken(token)
 	if err != nil {
 		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
 		return
 	}
 
+	// Tokens stop working once their session is revoked
+	err = models.CheckSession(sessionId, userId.Hex())
+	if err == models.ErrSessionRevoked {
+		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		context.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "unable to check session"})
+		fmt.Println(err)
+		return
+	}
+
 	// Set the user ID in the Gin context
 	context.Set("userId", userId.Hex()) // Convert ObjectID to string
+	context.Set("sessionId", sessionId)
+
+	context.Next()
+}
+
+// OptionalAuthenticate sets the user ID in the context when a valid token is
+// sent, and lets anonymous requests through otherwise. Public routes use it
+// to show owners their own drafts. API keys that are sent still have to be
+// valid.
+func OptionalAuthenticate(context *gin.Context) {
+	if key := context.GetHeader(apiKeyHeader); key != "" {
+		authenticateAPIKey(context, key)
+		return
+	}
+
+	token := bearerToken(context.Request.Header.Get("Authorization"))
+	if token != "" {
+		userId, sessionId, err := utils.VerifyToken(token)
+		if err == nil && models.CheckSession(sessionId, userId.Hex()) == nil {
+			context.Set("userId", userId.Hex())
+			context.Set("sessionId", sessionId)
+		}
+	}
 
 	context.Next()
 }
@@ -0,0 +1,104 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/goMongo/config"
+	"example.com/goMongo/models"
+	"github.com/gin-gonic/gin"
+)
+
+// How long a response stays available for replay
+var idempotencyTTL = config.Duration("IDEMPOTENCY_TTL", 24*time.Hour)
+
+// Idempotent lets clients retry a POST safely by sending an Idempotency-Key
+// header. The first response per user, key and route is stored and replayed
+// to retries, and reusing a key for a different body is rejected. It has to
+// run after Authenticate on routes that require a user.
+func Idempotent(context *gin.Context) {
+	key := context.Request.Header.Get("Idempotency-Key")
+	if key == "" {
+		context.Next()
+		return
+	}
+	if len(key) > 255 {
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Idempotency-Key must be at most 255 characters"})
+		return
+	}
+
+	body, err := io.ReadAll(context.Request.Body)
+	if err != nil {
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Invalid request data"})
+		return
+	}
+	context.Request.Body = io.NopCloser(bytes.NewReader(body))
+	hash := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(hash[:])
+
+	route := context.Request.Method + " " + context.Request.URL.Path
+	record, claimed, err := models.BeginIdempotentRequest(context.GetString("userId"), key, route, requestHash, idempotencyTTL)
+	if err != nil {
+		log.Println("Failed to check Idempotency-Key:", err)
+		context.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "unable to process request"})
+		return
+	}
+
+	if !claimed {
+		switch {
+		case record.RequestHash != requestHash:
+			context.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"message": "Idempotency-Key was already used for a different request"})
+		case !record.IsComplete():
+			context.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": "A request with this Idempotency-Key is still in progress"})
+		default:
+			context.Header("Idempotent-Replayed", "true")
+			context.Data(record.StatusCode, record.ContentType, record.Body)
+			context.Abort()
+		}
+		return
+	}
+
+	// Server errors and panics aren't stored, so the client can retry with
+	// the same key
+	completed := false
+	defer func() {
+		if !completed {
+			if err := models.ReleaseIdempotentRequest(record.ID); err != nil {
+				log.Println("Failed to release Idempotency-Key:", err)
+			}
+		}
+	}()
+
+	recorder := &responseRecorder{ResponseWriter: context.Writer}
+	context.Writer = recorder
+	context.Next()
+
+	if recorder.Status() < http.StatusInternalServerError {
+		if err := models.CompleteIdempotentRequest(record.ID, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			log.Println("Failed to store idempotent response:", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// responseRecorder keeps a copy of the response body written through it.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/goMongo/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit limits each client IP to limit on the routes it guards. Routes
+// sharing a name share their buckets.
+func RateLimit(name string, limit utils.RateLimit) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		allowed, retryAfter, err := utils.TakeToken("ip:"+name+":"+context.ClientIP(), limit)
+		if err != nil {
+			// Rather let requests through than lock everybody out
+			log.Println("Failed to check rate limit:", err)
+		} else if !allowed {
+			TooManyRequests(context, retryAfter)
+			return
+		}
+
+		context.Next()
+	}
+}
+
+// TooManyRequests aborts with 429 and tells the client when to try again.
+func TooManyRequests(context *gin.Context, retryAfter time.Duration) {
+	context.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	context.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "Too many attempts, try again later"})
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestContext tags every request with an ID and the client IP, which the
+// audit log records next to each change. A X-Request-ID sent by a proxy in
+// front of the server is kept, so entries can be matched with its logs.
+func RequestContext(context *gin.Context) {
+	requestId := context.Request.Header.Get("X-Request-ID")
+	if requestId == "" || len(requestId) > 128 {
+		requestId = newRequestId()
+	}
+
+	context.Set("requestId", requestId)
+	context.Set("clientIp", context.ClientIP())
+	context.Header("X-Request-ID", requestId)
+
+	context.Next()
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"example.com/goMongo/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ObjectIDParams rejects requests whose path parameters of the given names
+// aren't ObjectIDs, before handlers look them up.
+func ObjectIDParams(names ...string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var fieldErrs []utils.FieldError
+		for _, name := range names {
+			if !primitive.IsValidObjectID(context.Param(name)) {
+				fieldErrs = append(fieldErrs, utils.FieldError{Field: name, Rule: "objectid", Message: name + " must be a valid ID"})
+			}
+		}
+		if len(fieldErrs) > 0 {
+			context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Invalid request data", "errors": fieldErrs})
+			return
+		}
+
+		context.Next()
+	}
+}
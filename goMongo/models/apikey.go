@@ -0,0 +1,208 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"example.com/goMongo/db"
+	"example.com/goMongo/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Prefix of every API key, so leaked keys are easy to recognize
+const apiKeyPrefix = "gme_"
+
+// API key scopes. Each route an API key may call needs one of them, see
+// middlewares/apikey.go.
+const (
+	ScopeProfileRead        = "profile:read"
+	ScopeEventsRead         = "events:read"
+	ScopeEventsWrite        = "events:write"
+	ScopeRegistrationsRead  = "registrations:read"
+	ScopeRegistrationsWrite = "registrations:write"
+	ScopeCheckIn            = "checkin"
+	ScopeVenuesWrite        = "venues:write"
+	ScopeSeriesWrite        = "series:write"
+)
+
+// APIKeyScopes lists the scopes a key can be given.
+var APIKeyScopes = []string{
+	ScopeProfileRead,
+	ScopeEventsRead,
+	ScopeEventsWrite,
+	ScopeRegistrationsRead,
+	ScopeRegistrationsWrite,
+	ScopeCheckIn,
+	ScopeVenuesWrite,
+	ScopeSeriesWrite,
+}
+
+var (
+	ErrInvalidAPIKey  = errors.New("Invalid, expired or revoked API key")
+	ErrUnknownScope   = errors.New("Unknown scope, expected one of " + strings.Join(APIKeyScopes, ", "))
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// APIKey lets machine clients act as the user who created it, limited to
+// its scopes. Only a hash of the key is stored.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"` // Start of the key, to tell keys apart
+	KeyHash    string             `bson:"keyHash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"` // Never expires when unset
+	LastUsedAt *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// HasScope reports whether the key grants scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// hashToken hashes a random token such as an API key for storage and
+// lookup. The tokens are random enough that a fast hash is fine.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey creates a key for the user and returns it along with the key
+// itself, which can't be recovered later.
+func CreateAPIKey(ctx context.Context, userId primitive.ObjectID, name string, scopes []string, expiresAt *time.Time) (*APIKey, string, error) {
+	for _, scope := range scopes {
+		known := false
+		for _, s := range APIKeyScopes {
+			known = known || s == scope
+		}
+		if !known {
+			return nil, "", ErrUnknownScope
+		}
+	}
+
+	secret, err := utils.RandomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := APIKey{
+		ID:        primitive.NewObjectID(),
+		UserID:    userId,
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		KeyHash:   hashToken(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+
+	collection := db.GetDatabase().Collection("apiKeys")
+	if _, err := collection.InsertOne(ctx, apiKey); err != nil {
+		return nil, "", err
+	}
+	recordAudit(ctx, "apiKeys", AuditCreate, apiKey.ID, nil, apiKey)
+
+	return &apiKey, key, nil
+}
+
+// GetAPIKeys retrieves the keys of a user, newest first, revoked ones
+// included.
+func GetAPIKeys(userId primitive.ObjectID) ([]APIKey, error) {
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	// Get a handle to the collection.
+	collection := db.GetDatabase().Collection("apiKeys")
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"userId": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes one of the user's keys. Revoked keys are kept, so
+// the list still shows when they were last used.
+func RevokeAPIKey(ctx context.Context, userId primitive.ObjectID, id string) (*APIKey, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	filter := bson.M{"_id": objectID, "userId": userId, "revokedAt": nil}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}}
+	var apiKey APIKey
+	if err := updateOneAudited(ctx, "apiKeys", AuditUpdate, filter, update, &apiKey); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// AuthenticateAPIKey returns the key a request was sent with, if it is
+// still valid and its owner still exists.
+func AuthenticateAPIKey(key string) (*APIKey, error) {
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	collection := db.GetDatabase().Collection("apiKeys")
+	var apiKey APIKey
+	if err := collection.FindOne(ctx, bson.M{"keyHash": hashToken(key)}).Decode(&apiKey); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if apiKey.RevokedAt != nil || apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+	owner, err := GetUserById(apiKey.UserID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if owner == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Recording every request would mean a write per request, a minute is
+	// precise enough
+	_, err = collection.UpdateOne(ctx,
+		bson.M{"_id": apiKey.ID, "lastUsedAt": bson.M{"$not": bson.M{"$gt": now.Add(-time.Minute)}}},
+		bson.M{"$set": bson.M{"lastUsedAt": now}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
@@ -0,0 +1,295 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"time"
+
+	"example.com/goMongo/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Audit actions
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// Actors recorded for changes nobody signed in made
+const (
+	SystemActor    = "system"    // Background jobs
+	AnonymousActor = "anonymous" // Requests without a token, such as sign up
+)
+
+// Fields whose values never end up in the audit log
+var redactedAuditFields = map[string]bool{
+	"password":        true,
+	"ticketCode":      true,
+	"mfa":             true,
+	"keyHash":         true,
+	"calendarFeedKey": true,
+}
+
+// AuditEntry records one mutation. Entries are only ever inserted, never
+// updated or deleted, so the audit collection is append-only.
+type AuditEntry struct {
+	ID         primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	Collection string                 `bson:"collection" json:"collection"`
+	DocumentID *primitive.ObjectID    `bson:"documentId,omitempty" json:"documentId,omitempty"` // Unset for bulk changes
+	Filter     string                 `bson:"filter,omitempty" json:"filter,omitempty"`         // Extended JSON of the filter a bulk change matched
+	Update     string                 `bson:"update,omitempty" json:"update,omitempty"`         // Extended JSON of the update a bulk change applied
+	Count      int64                  `bson:"count,omitempty" json:"count,omitempty"`           // Documents a bulk change modified
+	Action     string                 `bson:"action" json:"action"`
+	ActorID    string                 `bson:"actorId" json:"actorId"`
+	RequestID  string                 `bson:"requestId,omitempty" json:"requestId,omitempty"`
+	ClientIP   string                 `bson:"clientIp,omitempty" json:"clientIp,omitempty"`
+	Timestamp  time.Time              `bson:"timestamp" json:"timestamp"`
+	Changes    map[string]AuditChange `bson:"changes,omitempty" json:"changes,omitempty"`
+}
+
+// AuditChange is the value of a field before and after a mutation.
+type AuditChange struct {
+	Before interface{} `bson:"before,omitempty" json:"before,omitempty"`
+	After  interface{} `bson:"after,omitempty" json:"after,omitempty"`
+}
+
+// AuditFilter narrows down ListAudit. Empty fields don't filter.
+type AuditFilter struct {
+	Collection string
+	DocumentID string
+	ActorID    string
+	Action     string
+	RequestID  string
+	From       time.Time
+	To         time.Time
+	Page       int64
+	Limit      int64
+}
+
+// newAuditEntry fills in who made a change from the context. Handlers pass
+// their *gin.Context, whose Value method exposes the "userId", "requestId"
+// and "clientIp" keys set by the middlewares.
+func newAuditEntry(ctx context.Context, collection, action string) AuditEntry {
+	entry := AuditEntry{
+		Collection: collection,
+		Action:     action,
+		ActorID:    SystemActor,
+		Timestamp:  time.Now().UTC(),
+	}
+	if userId, ok := ctx.Value("userId").(string); ok && userId != "" {
+		entry.ActorID = userId
+	}
+	if requestId, ok := ctx.Value("requestId").(string); ok {
+		entry.RequestID = requestId
+		if entry.ActorID == SystemActor {
+			entry.ActorID = AnonymousActor
+		}
+	}
+	if clientIP, ok := ctx.Value("clientIp").(string); ok {
+		entry.ClientIP = clientIP
+	}
+	return entry
+}
+
+// recordAudit logs a change to a single document. before is nil for
+// creations and after is nil for deletions. A failure to write the entry is
+// logged rather than failing the mutation, which has already happened.
+func recordAudit(ctx context.Context, collection, action string, id primitive.ObjectID, before, after interface{}) {
+	entry := newAuditEntry(ctx, collection, action)
+	entry.DocumentID = &id
+	entry.Changes = auditDiff(before, after)
+	insertAudit(ctx, entry)
+}
+
+// recordBulkAudit logs a change applied to every document matching filter.
+// The update is kept as is, since the documents aren't read back.
+func recordBulkAudit(ctx context.Context, collection, action string, filter bson.M, update bson.M, count int64) {
+	if count == 0 {
+		return
+	}
+	entry := newAuditEntry(ctx, collection, action)
+	entry.Filter = auditJSON(filter)
+	if update != nil {
+		entry.Update = auditJSON(update)
+	}
+	entry.Count = count
+	insertAudit(ctx, entry)
+}
+
+// updateOneAudited applies update to the first document matching filter,
+// records the change and decodes the updated document into result when it
+// isn't nil. It returns mongo.ErrNoDocuments when nothing matched.
+func updateOneAudited(ctx context.Context, collectionName, action string, filter, update bson.M, result interface{}) error {
+	collection := db.GetDatabase().Collection(collectionName)
+
+	var before bson.M
+	if err := collection.FindOneAndUpdate(ctx, filter, withVersionBump(collectionName, update)).Decode(&before); err != nil {
+		return err
+	}
+	id, _ := before["_id"].(primitive.ObjectID)
+
+	var after bson.M
+	if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&after); err != nil {
+		return err
+	}
+	recordAudit(ctx, collectionName, action, id, before, after)
+
+	if result == nil {
+		return nil
+	}
+	raw, err := bson.Marshal(after)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, result)
+}
+
+// updateManyAudited applies update to every document matching filter and
+// records it as one bulk entry.
+func updateManyAudited(ctx context.Context, collectionName, action string, filter, update bson.M) (*mongo.UpdateResult, error) {
+	result, err := db.GetDatabase().Collection(collectionName).UpdateMany(ctx, filter, withVersionBump(collectionName, update))
+	if err != nil {
+		return nil, err
+	}
+	recordBulkAudit(ctx, collectionName, action, filter, update, result.ModifiedCount)
+	return result, nil
+}
+
+// deleteManyAudited permanently removes every document matching filter and
+// records it as one bulk entry.
+func deleteManyAudited(ctx context.Context, collectionName string, filter bson.M) (*mongo.DeleteResult, error) {
+	result, err := db.GetDatabase().Collection(collectionName).DeleteMany(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	recordBulkAudit(ctx, collectionName, AuditPurge, filter, nil, result.DeletedCount)
+	return result, nil
+}
+
+func insertAudit(ctx context.Context, entry AuditEntry) {
+	if _, err := db.GetDatabase().Collection("audit").InsertOne(ctx, entry); err != nil {
+		log.Println("Failed to write audit entry:", err)
+	}
+}
+
+func auditJSON(doc bson.M) string {
+	raw, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+// auditDiff compares two versions of a document field by field and returns
+// the fields that differ.
+func auditDiff(before, after interface{}) map[string]AuditChange {
+	beforeDoc := toAuditDoc(before)
+	afterDoc := toAuditDoc(after)
+
+	changes := map[string]AuditChange{}
+	for field, value := range afterDoc {
+		if old, ok := beforeDoc[field]; !ok || !reflect.DeepEqual(old, value) {
+			changes[field] = AuditChange{Before: old, After: value}
+		}
+	}
+	for field, value := range beforeDoc {
+		if _, ok := afterDoc[field]; !ok {
+			changes[field] = AuditChange{Before: value}
+		}
+	}
+
+	for field := range changes {
+		if redactedAuditFields[field] {
+			changes[field] = AuditChange{Before: "[redacted]", After: "[redacted]"}
+		}
+	}
+	delete(changes, "_id")
+	return changes
+}
+
+// toAuditDoc converts a model or update document to a flat bson.M by
+// round-tripping it through BSON, so both sides compare the same way.
+func toAuditDoc(value interface{}) bson.M {
+	if value == nil || reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil() {
+		return bson.M{}
+	}
+	raw, err := bson.Marshal(value)
+	if err != nil {
+		return bson.M{}
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return bson.M{}
+	}
+	return doc
+}
+
+// ListAudit retrieves audit entries, newest first.
+func ListAudit(filter AuditFilter) ([]AuditEntry, int64, error) {
+	query := bson.M{}
+	if filter.Collection != "" {
+		query["collection"] = filter.Collection
+	}
+	if filter.DocumentID != "" {
+		documentId, err := primitive.ObjectIDFromHex(filter.DocumentID)
+		if err != nil {
+			return nil, 0, errors.New("Invalid document ID format")
+		}
+		query["documentId"] = documentId
+	}
+	if filter.ActorID != "" {
+		query["actorId"] = filter.ActorID
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.RequestID != "" {
+		query["requestId"] = filter.RequestID
+	}
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		timeRange := bson.M{}
+		if !filter.From.IsZero() {
+			timeRange["$gte"] = filter.From
+		}
+		if !filter.To.IsZero() {
+			timeRange["$lt"] = filter.To
+		}
+		query["timestamp"] = timeRange
+	}
+
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	// Get a handle to the collection.
+	collection := db.GetDatabase().Collection("audit")
+
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip((filter.Page - 1) * filter.Limit).
+		SetLimit(filter.Limit)
+
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := []AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"example.com/goMongo/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Calendar feed tokens are signed over the user's feed key, a random value
+// stored with the user. Rotating the key replaces the token and revoking it
+// turns the feed off, until the user asks for a new link.
+
+var ErrInvalidCalendarToken = errors.New("Invalid or revoked calendar token")
+
+// CalendarToken returns the token of the user's calendar feed, creating
+// their feed key when they don't have one yet.
+func CalendarToken(ctx context.Context, user *User) (string, error) {
+	if user.CalendarFeedKey != "" {
+		return utils.GenerateCalendarToken(user.ID, user.CalendarFeedKey), nil
+	}
+
+	// Only set the key when there still is none, so two first requests
+	// don't revoke each other's token
+	err := setCalendarFeedKey(ctx, notDeleted(bson.M{"_id": user.ID, "calendarFeedKey": bson.M{"$exists": false}}), user)
+	if err == mongo.ErrNoDocuments {
+		existing, err := GetUserById(user.ID.Hex())
+		if err != nil {
+			return "", err
+		}
+		if existing == nil || existing.CalendarFeedKey == "" {
+			return "", errors.New("user not found")
+		}
+		*user = *existing
+	} else if err != nil {
+		return "", err
+	}
+	return utils.GenerateCalendarToken(user.ID, user.CalendarFeedKey), nil
+}
+
+// RotateCalendarToken replaces the user's feed key and returns the new
+// token. Tokens handed out before stop working.
+func RotateCalendarToken(ctx context.Context, user *User) (string, error) {
+	if err := setCalendarFeedKey(ctx, notDeleted(bson.M{"_id": user.ID}), user); err != nil {
+		return "", err
+	}
+	return utils.GenerateCalendarToken(user.ID, user.CalendarFeedKey), nil
+}
+
+// RevokeCalendarToken removes the user's feed key, which turns their
+// calendar feed off.
+func RevokeCalendarToken(ctx context.Context, user *User) error {
+	update := bson.M{"$unset": bson.M{"calendarFeedKey": ""}}
+	return updateOneAudited(ctx, "users", AuditUpdate, notDeleted(bson.M{"_id": user.ID}), update, user)
+}
+
+// AuthenticateCalendarToken returns the user a calendar feed token belongs
+// to, if it was made with their current feed key.
+func AuthenticateCalendarToken(token string) (*User, error) {
+	userId, err := utils.CalendarTokenUser(token)
+	if err != nil {
+		return nil, ErrInvalidCalendarToken
+	}
+	user, err := GetUserById(userId.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !utils.VerifyCalendarToken(token, user.ID, user.CalendarFeedKey) {
+		return nil, ErrInvalidCalendarToken
+	}
+	return user, nil
+}
+
+func setCalendarFeedKey(ctx context.Context, filter bson.M, user *User) error {
+	feedKey, err := utils.RandomString(32)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$set": bson.M{"calendarFeedKey": feedKey}}
+	return updateOneAudited(ctx, "users", AuditUpdate, filter, update, user)
+}
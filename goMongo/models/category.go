@@ -0,0 +1,243 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"example.com/goMongo/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxEventTags limits how many tags a single event can carry.
+const maxEventTags = 20
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Category is an admin-managed topic events can be browsed by. Events refer
+// to a category by its slug.
+type Category struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Slug        string             `binding:"required,max=64" bson:"slug" json:"slug"`
+	Name        string             `binding:"required,notblank,max=100" bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	EventCount  int64              `bson:"-" json:"eventCount"`
+}
+
+func InsertCategory(category *Category) (*mongo.InsertOneResult, error) {
+	category.Slug = strings.ToLower(strings.TrimSpace(category.Slug))
+	if !slugPattern.MatchString(category.Slug) {
+		return nil, errors.New("Slug may only contain lowercase letters, digits and dashes")
+	}
+
+	collection := db.GetDatabase().Collection("categories")
+	result, err := collection.InsertOne(context.TODO(), category)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.New("Category already exists")
+		}
+		return nil, err
+	}
+
+	// Set the ID field of the category to the inserted ID
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		category.ID = oid
+	} else {
+		return nil, fmt.Errorf("failed to convert inserted ID to ObjectID")
+	}
+
+	return result, nil
+}
+
+// GetCategoryBySlug retrieves a category by its slug.
+func GetCategoryBySlug(slug string) (*Category, error) {
+	ctx := context.Background()
+
+	collection := db.GetDatabase().Collection("categories")
+
+	var category Category
+	if err := collection.FindOne(ctx, bson.M{"slug": slug}).Decode(&category); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // Category not found
+		}
+		return nil, err // Other error occurred
+	}
+
+	return &category, nil
+}
+
+// GetCategories retrieves all categories with the number of events in each.
+func GetCategories() ([]Category, error) {
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	// Get a handle to the collection.
+	collection := db.GetDatabase().Collection("categories")
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err // Other error occurred
+	}
+	categories := []Category{}
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+
+	// Count the events of every category in one pass
+	countCursor, err := db.GetDatabase().Collection("events").Aggregate(ctx, []bson.M{
+		{"$match": notDeleted(bson.M{"category": bson.M{"$nin": []interface{}{nil, ""}}})},
+		{"$group": bson.M{"_id": "$category", "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var counts []FacetCount
+	if err := countCursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	bySlug := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		bySlug[count.Value] = count.Count
+	}
+
+	for i := range categories {
+		categories[i].EventCount = bySlug[categories[i].Slug]
+	}
+
+	return categories, nil
+}
+
+// UpdateCategory changes the name and description of a category. The slug
+// is what events refer to, so it can't be changed.
+func UpdateCategory(slug string, name, description string) (*Category, error) {
+	ctx := context.Background()
+
+	collection := db.GetDatabase().Collection("categories")
+
+	update := bson.M{"$set": bson.M{"name": name, "description": description}}
+
+	var category Category
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"slug": slug}, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&category); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // Category not found
+		}
+		return nil, err // Other error occurred
+	}
+
+	return &category, nil
+}
+
+// DeleteCategory removes a category that no event uses anymore.
+func DeleteCategory(slug string) (*Category, error) {
+	ctx := context.Background()
+
+	count, err := db.GetDatabase().Collection("events").CountDocuments(ctx, bson.M{"category": slug})
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("Category is still used by %d events", count)
+	}
+
+	collection := db.GetDatabase().Collection("categories")
+
+	var category Category
+	if err := collection.FindOneAndDelete(ctx, bson.M{"slug": slug}).Decode(&category); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // Category not found
+		}
+		return nil, err // Other error occurred
+	}
+
+	return &category, nil
+}
+
+// NormalizeTags lower-cases, trims and de-duplicates free-form tags.
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > 50 {
+			return nil, fmt.Errorf("Tag %q is longer than 50 characters", tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxEventTags {
+		return nil, fmt.Errorf("An event can have at most %d tags", maxEventTags)
+	}
+	return normalized, nil
+}
+
+// ValidateTaxonomy checks that the event's category exists and normalizes
+// its tags.
+func (e *Event) ValidateTaxonomy() error {
+	if e.Category != "" {
+		category, err := GetCategoryBySlug(e.Category)
+		if err != nil {
+			return err
+		}
+		if category == nil {
+			return fmt.Errorf("Unknown category %q", e.Category)
+		}
+	}
+
+	tags, err := NormalizeTags(e.Tags)
+	if err != nil {
+		return err
+	}
+	e.Tags = tags
+	return nil
+}
+
+// ApplyTaxonomyUpdate validates category and tag changes in a raw update.
+func ApplyTaxonomyUpdate(event *Event, updateData bson.M) error {
+	_, hasCategory := updateData["category"]
+	_, hasTags := updateData["tags"]
+	if !hasCategory && !hasTags {
+		return nil
+	}
+
+	if hasCategory {
+		category, ok := updateData["category"].(string)
+		if !ok && updateData["category"] != nil {
+			return errors.New("category must be a string")
+		}
+		event.Category = category
+	}
+	if hasTags {
+		event.Tags = []string{}
+		switch values := updateData["tags"].(type) {
+		case nil:
+		case []string:
+			event.Tags = append(event.Tags, values...)
+		case []interface{}:
+			for _, value := range values {
+				tag, ok := value.(string)
+				if !ok {
+					return errors.New("tags must be a list of strings")
+				}
+				event.Tags = append(event.Tags, tag)
+			}
+		default:
+			return errors.New("tags must be a list of strings")
+		}
+	}
+
+	if err := event.ValidateTaxonomy(); err != nil {
+		return err
+	}
+
+	updateData["category"] = event.Category
+	updateData["tags"] = event.Tags
+	return nil
+}
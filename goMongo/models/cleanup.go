@@ -0,0 +1,258 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"example.com/goMongo/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Deletion policy
+//
+// Users, events and registrations are soft deleted first (see softdelete.go)
+// and purged for good once the retention window has passed.
+//
+// Deleting an event deletes its registrations with it. Events can only be
+// deleted once nobody is registered anymore; otherwise they are cancelled.
+//
+// Deleting a user revokes their sessions, and transfers their events, series
+// and venues to another user when an admin gives one. Otherwise their
+// upcoming events are cancelled and the registrants notified. When the user
+// is purged:
+//   - their registrations are anonymized: the user reference is cleared, and
+//     registrations for upcoming events are cancelled;
+//   - everything the user still owns is marked as having a deleted owner
+//     (the nil ObjectID).
+//
+// Each step runs in one transaction, and notifications go out after it
+// commits.
+
+// DeletedUserID marks references to users that no longer exist.
+var DeletedUserID = primitive.NilObjectID
+
+// ErrTransferTarget is returned when the user to transfer events to is
+// missing or is the user being deleted.
+var ErrTransferTarget = errors.New("Events can only be transferred to another existing user")
+
+// cancelledEvent is an event cancelled by a cascade together with the
+// registrations whose users have to be told.
+type cancelledEvent struct {
+	event         Event
+	registrations []Registration
+}
+
+// anonymizeUserRegistrations clears the user reference of every registration
+// of the user and cancels the ones for events that haven't ended.
+func anonymizeUserRegistrations(ctx context.Context, userId primitive.ObjectID) error {
+	registrations := db.GetDatabase().Collection("registrations")
+
+	eventIds, err := registrations.Distinct(ctx, "eventId", bson.M{"userId": userId, "status": RegistrationStatusRegistered})
+	if err != nil {
+		return err
+	}
+	upcomingIds, err := db.GetDatabase().Collection("events").Distinct(ctx, "_id", notEnded(bson.M{
+		"_id": bson.M{"$in": eventIds},
+	}, time.Now().UTC()))
+	if err != nil {
+		return err
+	}
+
+	_, err = updateManyAudited(ctx, "registrations", AuditUpdate,
+		bson.M{"userId": userId, "status": RegistrationStatusRegistered, "eventId": bson.M{"$in": upcomingIds}},
+		bson.M{"$set": bson.M{"status": RegistrationStatusCancelled}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = updateManyAudited(ctx, "registrations", AuditUpdate,
+		bson.M{"userId": userId},
+		bson.M{"$set": bson.M{"userId": DeletedUserID, "anonymized": true}},
+	)
+	return err
+}
+
+// cancelUpcomingEvents cancels the events of a user that haven't ended and
+// returns them so their registrants can be notified.
+func cancelUpcomingEvents(ctx context.Context, userId primitive.ObjectID) ([]cancelledEvent, error) {
+	events := db.GetDatabase().Collection("events")
+
+	filter := notDeleted(notEnded(bson.M{
+		"userId": userId,
+		"status": bson.M{"$nin": []string{EventStatusCancelled, EventStatusCompleted}},
+	}, time.Now().UTC()))
+	cursor, err := events.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var upcoming []Event
+	if err := cursor.All(ctx, &upcoming); err != nil {
+		return nil, err
+	}
+
+	var cancelled []cancelledEvent
+	for _, event := range upcoming {
+		if err := updateOneAudited(ctx, "events", AuditUpdate, bson.M{"_id": event.ID}, bson.M{"$set": bson.M{"status": EventStatusCancelled, "isAvailable": false}}, nil); err != nil {
+			return nil, err
+		}
+		registrations, err := cancelEventRegistrations(ctx, event.ID)
+		if err != nil {
+			return nil, err
+		}
+		cancelled = append(cancelled, cancelledEvent{event: event, registrations: registrations})
+	}
+
+	return cancelled, nil
+}
+
+// transferUserEvents hands the events, series and venues of a user over to
+// newOwner, which is DeletedUserID when nobody takes them over.
+func transferUserEvents(ctx context.Context, userId, newOwner primitive.ObjectID) error {
+	for _, collection := range []string{"events", "series", "venues"} {
+		_, err := updateManyAudited(ctx, collection, AuditUpdate,
+			bson.M{"userId": userId},
+			bson.M{"$set": bson.M{"userId": newOwner}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeUserReferences applies the deletion policy for a user that is gone
+// for good: registrations are anonymized, upcoming events cancelled and the
+// rest of what the user owned is marked with DeletedUserID.
+func removeUserReferences(ctx context.Context, userId primitive.ObjectID) ([]cancelledEvent, error) {
+	if err := anonymizeUserRegistrations(ctx, userId); err != nil {
+		return nil, err
+	}
+	cancelled, err := cancelUpcomingEvents(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := transferUserEvents(ctx, userId, DeletedUserID); err != nil {
+		return nil, err
+	}
+	return cancelled, nil
+}
+
+// RepairOrphans fixes references left behind by deletions that happened
+// before the deletion policy existed: registrations of missing events are
+// deleted, and missing users are handled like deleted ones.
+func RepairOrphans() error {
+	ctx := context.Background()
+
+	// Registrations pointing at events that no longer exist
+	orphanIds, err := findOrphans(ctx, "registrations", "eventId", "events")
+	if err != nil {
+		return err
+	}
+	if len(orphanIds) > 0 {
+		if _, err := deleteManyAudited(ctx, "registrations", bson.M{"_id": bson.M{"$in": orphanIds}}); err != nil {
+			return err
+		}
+		log.Println("Deleted", len(orphanIds), "registrations of missing events")
+	}
+
+	// Users referenced by registrations, events, series or venues that are gone
+	missingUsers := map[primitive.ObjectID]bool{}
+	for _, collection := range []string{"registrations", "events", "series", "venues"} {
+		ids, err := findMissingReferences(ctx, collection, "userId", "users")
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			missingUsers[id] = true
+		}
+	}
+
+	for userId := range missingUsers {
+		var cancelled []cancelledEvent
+		err := db.WithTransaction(ctx, func(ctx mongo.SessionContext) error {
+			var err error
+			cancelled, err = removeUserReferences(ctx, userId)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, c := range cancelled {
+			notifyEventCancelled(&c.event, c.registrations, "The organizer's account was deleted.")
+		}
+		log.Println("Repaired references to missing user", userId.Hex())
+	}
+
+	return nil
+}
+
+// findOrphans returns the IDs of documents in collection whose field points
+// at a document missing from target.
+func findOrphans(ctx context.Context, collection, field, target string) ([]primitive.ObjectID, error) {
+	cursor, err := db.GetDatabase().Collection(collection).Aggregate(ctx, []bson.M{
+		{"$lookup": bson.M{"from": target, "localField": field, "foreignField": "_id", "as": "ref"}},
+		{"$match": bson.M{"ref": bson.M{"$size": 0}}},
+		{"$project": bson.M{"_id": 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
+
+// findMissingReferences returns the distinct values of field in collection
+// that don't exist in target, ignoring DeletedUserID.
+func findMissingReferences(ctx context.Context, collection, field, target string) ([]primitive.ObjectID, error) {
+	cursor, err := db.GetDatabase().Collection(collection).Aggregate(ctx, []bson.M{
+		{"$match": bson.M{field: bson.M{"$ne": DeletedUserID}}},
+		{"$group": bson.M{"_id": "$" + field}},
+		{"$lookup": bson.M{"from": target, "localField": "_id", "foreignField": "_id", "as": "ref"}},
+		{"$match": bson.M{"ref": bson.M{"$size": 0}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
+
+// StartOrphanRepair runs RepairOrphans every interval in the background,
+// starting right away.
+func StartOrphanRepair(interval time.Duration) {
+	go func() {
+		for {
+			if err := RepairOrphans(); err != nil && !errors.Is(err, mongo.ErrClientDisconnected) {
+				log.Println("Failed to repair orphaned references:", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
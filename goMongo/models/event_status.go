@@ -0,0 +1,255 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"example.com/goMongo/db"
+	"example.com/goMongo/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Event statuses. Events stored before statuses existed have none and are
+// treated as published.
+const (
+	EventStatusDraft     = "draft"
+	EventStatusPublished = "published"
+	EventStatusCancelled = "cancelled"
+	EventStatusCompleted = "completed"
+)
+
+// IsPublic reports whether anyone, not just the owner, may see the event.
+func (e *Event) IsPublic() bool {
+	switch e.Status {
+	case "", EventStatusPublished, EventStatusCancelled, EventStatusCompleted:
+		return true
+	case EventStatusDraft:
+		// A scheduled draft is public once its publish time has passed, even
+		// if the scheduler hasn't flipped its status yet
+		return e.PublishAt != nil && !e.PublishAt.After(time.Now())
+	}
+	return false
+}
+
+// IsVisibleTo reports whether the user with the given ID may see the event.
+func (e *Event) IsVisibleTo(userIdStr string) bool {
+	return e.IsPublic() || (userIdStr != "" && e.UserID.Hex() == userIdStr)
+}
+
+// IsOpen reports whether the event accepts registrations.
+func (e *Event) IsOpen() bool {
+	return e.IsAvailable && (e.Status == "" || e.Status == EventStatusPublished || (e.Status == EventStatusDraft && e.IsPublic()))
+}
+
+// publicEventsFilter matches the events IsPublic accepts.
+func publicEventsFilter() bson.M {
+	return bson.M{"$or": []bson.M{
+		{"status": bson.M{"$in": []interface{}{nil, EventStatusPublished, EventStatusCancelled, EventStatusCompleted}}},
+		{"status": EventStatusDraft, "publishAt": bson.M{"$lte": time.Now().UTC()}},
+	}}
+}
+
+// visibleTo restricts a filter to the events the viewer may see: public
+// events, plus their own drafts when a viewer is given.
+func visibleTo(filter bson.M, viewerIdStr string) bson.M {
+	visibility := publicEventsFilter()
+	if viewerId, err := primitive.ObjectIDFromHex(viewerIdStr); err == nil {
+		visibility = bson.M{"$or": []bson.M{visibility, {"userId": viewerId}}}
+	}
+	if len(filter) == 0 {
+		return visibility
+	}
+	return bson.M{"$and": []bson.M{filter, visibility}}
+}
+
+// PublishEvent publishes a draft right away, or schedules it for publishAt
+// when that is in the future.
+func PublishEvent(ctx context.Context, id string, publishAt *time.Time) (*Event, error) {
+	event, err := GetEventById(id)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, nil
+	}
+	if event.Status != EventStatusDraft {
+		return nil, fmt.Errorf("Only drafts can be published, this event is %s", eventStatusName(event.Status))
+	}
+
+	now := time.Now().UTC()
+	update := bson.M{"status": EventStatusPublished, "publishAt": now}
+	if publishAt != nil && publishAt.After(now) {
+		update = bson.M{"publishAt": publishAt.UTC()}
+	}
+
+	return UpdateEvent(ctx, id, update)
+}
+
+// CancelEvent cancels an event while keeping it and its registrations, and
+// lets every registrant know through the configured notifier.
+func CancelEvent(ctx context.Context, id string, reason string) (*Event, error) {
+	event, err := GetEventById(id)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, nil
+	}
+	if event.Status == EventStatusCancelled || event.Status == EventStatusCompleted {
+		return nil, fmt.Errorf("The event is already %s", event.Status)
+	}
+
+	cancelled, err := UpdateEvent(ctx, id, bson.M{"status": EventStatusCancelled, "isAvailable": false})
+	if err != nil {
+		return nil, err
+	}
+
+	registrations, err := cancelEventRegistrations(ctx, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	notifyEventCancelled(event, registrations, reason)
+
+	return cancelled, nil
+}
+
+// cancelEventRegistrations marks the active registrations of an event as
+// cancelled and returns them so their users can be notified.
+func cancelEventRegistrations(ctx context.Context, eventId primitive.ObjectID) ([]Registration, error) {
+	collection := db.GetDatabase().Collection("registrations")
+
+	filter := notDeleted(bson.M{"eventId": eventId, "status": RegistrationStatusRegistered})
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var registrations []Registration
+	if err := cursor.All(ctx, &registrations); err != nil {
+		return nil, err
+	}
+
+	if _, err := updateManyAudited(ctx, "registrations", AuditUpdate, filter, bson.M{"$set": bson.M{"status": RegistrationStatusCancelled}}); err != nil {
+		return nil, err
+	}
+
+	return registrations, nil
+}
+
+// notifyEventCancelled tells the users of the given registrations that the
+// event was cancelled. A failed notification is logged rather than undoing
+// the cancellation.
+func notifyEventCancelled(event *Event, registrations []Registration, reason string) {
+	body := fmt.Sprintf("%q on %s has been cancelled.", event.Name, event.DateTime.Format(time.RFC1123))
+	if reason != "" {
+		body += " Reason: " + reason
+	}
+	for _, registration := range registrations {
+		user, err := GetUserById(registration.UserID.Hex())
+		if err != nil || user == nil {
+			continue
+		}
+		err = utils.Notify(utils.Notification{
+			UserID:  user.ID.Hex(),
+			Email:   user.Email,
+			Name:    user.Name,
+			Subject: "Event cancelled: " + event.Name,
+			Body:    body,
+		})
+		if err != nil {
+			log.Println("Failed to notify user", user.ID.Hex(), "about cancelled event:", err)
+		}
+	}
+}
+
+// activeRegistrations returns the registrations of an event whose users
+// still plan to come.
+func activeRegistrations(ctx context.Context, eventId primitive.ObjectID) ([]Registration, error) {
+	filter := notDeleted(bson.M{"eventId": eventId, "status": RegistrationStatusRegistered})
+	cursor, err := db.GetDatabase().Collection("registrations").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var registrations []Registration
+	if err := cursor.All(ctx, &registrations); err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+// notifyEventRescheduled tells the users of the given registrations that
+// the event moved to a new time.
+func notifyEventRescheduled(before, after *Event, registrations []Registration) {
+	body := fmt.Sprintf("%q has moved from %s to %s.", after.Name, before.DateTime.Format(time.RFC1123), after.DateTime.Format(time.RFC1123))
+	for _, registration := range registrations {
+		user, err := GetUserById(registration.UserID.Hex())
+		if err != nil || user == nil {
+			continue
+		}
+		err = utils.Notify(utils.Notification{
+			UserID:  user.ID.Hex(),
+			Email:   user.Email,
+			Name:    user.Name,
+			Subject: "Event rescheduled: " + after.Name,
+			Body:    body,
+		})
+		if err != nil {
+			log.Println("Failed to notify user", user.ID.Hex(), "about rescheduled event:", err)
+		}
+	}
+}
+
+// HasActiveRegistrations reports whether anyone is still registered for the
+// event or has attended it.
+func HasActiveRegistrations(eventId primitive.ObjectID) (bool, error) {
+	filter := notDeleted(bson.M{"eventId": eventId, "status": bson.M{"$in": []string{RegistrationStatusRegistered, RegistrationStatusAttended}}})
+	count, err := db.GetDatabase().Collection("registrations").CountDocuments(context.Background(), filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// UpdateEventStatuses publishes drafts whose publish time has come and
+// completes published events that have ended.
+func UpdateEventStatuses() error {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	_, err := updateManyAudited(ctx, "events", AuditUpdate,
+		bson.M{"status": EventStatusDraft, "publishAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"status": EventStatusPublished}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = updateManyAudited(ctx, "events", AuditUpdate,
+		bson.M{"status": bson.M{"$in": []interface{}{nil, EventStatusPublished}}, "endDateTime": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"status": EventStatusCompleted, "isAvailable": false}},
+	)
+	return err
+}
+
+// StartEventScheduler runs UpdateEventStatuses every interval in the
+// background.
+func StartEventScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := UpdateEventStatuses(); err != nil && !errors.Is(err, mongo.ErrClientDisconnected) {
+				log.Println("Failed to update event statuses:", err)
+			}
+		}
+	}()
+}
+
+func eventStatusName(status string) string {
+	if status == "" {
+		return EventStatusPublished
+	}
+	return status
+}
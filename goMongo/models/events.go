@@ -13,75 +13,252 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// How long events last when they are created without an end
+const defaultEventDuration = time.Hour
+
 type Event struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name        string             `binding:"required" bson:"name" json:"name"`
-	Description string             `binding:"required" bson:"description" json:"description"`
-	Location    string             `binding:"required" bson:"location" json:"location"`
-	DateTime    time.Time          `binding:"required" bson:"dateTime" json:"dateTime"`
-	IsAvailable bool               `bson:"isAvailable" json:"isAvailable"`
-	UserID      primitive.ObjectID `bson:"userId" json:"userId"` // Reference to the User's ObjectID
-	User        *User              `bson:"-" json:"user"`        // Embedded user data
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Name        string              `binding:"required,notblank,max=200" bson:"name" json:"name"`
+	Description string              `binding:"required,max=5000" bson:"description" json:"description"`
+	Location    string              `bson:"location" json:"location"` // Required unless the event is held at a venue
+	VenueID     *primitive.ObjectID `bson:"venueId,omitempty" json:"venueId,omitempty"`
+	Capacity    int                 `bson:"capacity" json:"capacity"`                           // Most active registrations, 0 for no limit
+	Coordinates *GeoPoint           `bson:"coordinates,omitempty" json:"coordinates,omitempty"` // Optional position of the location
+	DateTime    time.Time           `binding:"required,future" bson:"dateTime" json:"dateTime"` // Start of the event, stored in UTC
+	EndDateTime time.Time           `bson:"endDateTime" json:"endDateTime"`                     // End of the event, stored in UTC. An hour after the start by default
+	TimeZone    string              `bson:"timeZone" json:"timeZone"`                           // IANA time zone the event takes place in
+	Category    string              `bson:"category" json:"category"`                           // Slug of an admin-managed Category
+	Tags        []string            `bson:"tags" json:"tags"`
+	Status      string              `bson:"status" json:"status"`                           // draft, published, cancelled or completed
+	PublishAt   *time.Time          `bson:"publishAt,omitempty" json:"publishAt,omitempty"` // When a draft goes public
+	IsAvailable bool                `bson:"isAvailable" json:"isAvailable"`
+	UserID      primitive.ObjectID  `bson:"userId" json:"userId"` // Reference to the User's ObjectID
+	User        *User               `bson:"-" json:"user"`        // Embedded user data
+	DeletedAt   *time.Time          `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	Version     int64               `bson:"version" json:"version"` // Incremented on every update
+	Local       *EventLocalTime     `bson:"-" json:"local,omitempty"`
+
+	// Set on events materialized from an EventSeries. OccurrenceStart is the
+	// start the series rule produced, even if the occurrence was rescheduled.
+	// CancelledBySeries tells occurrences the series cancelled apart from
+	// ones their organizer cancelled, only the former come back when the
+	// series produces them again.
+	SeriesID          *primitive.ObjectID `bson:"seriesId,omitempty" json:"seriesId,omitempty"`
+	OccurrenceStart   *time.Time          `bson:"occurrenceStart,omitempty" json:"occurrenceStart,omitempty"`
+	CancelledBySeries bool                `bson:"cancelledBySeries,omitempty" json:"-"`
 }
 
-func InsertEvent(event *Event) (*mongo.InsertOneResult, error) {
-	collection := db.GetDatabase().Collection("events")
-	result, err := collection.InsertOne(context.TODO(), event)
-	if err != nil {
-		return nil, err
+// EventLocalTime is the schedule of an event rendered in its own time zone.
+type EventLocalTime struct {
+	TimeZone    string `json:"timeZone"`
+	DateTime    string `json:"dateTime"`
+	EndDateTime string `json:"endDateTime,omitempty"`
+}
+
+// Duration returns how long the event lasts, or zero if it has no end.
+func (e *Event) Duration() time.Duration {
+	if e.EndDateTime.IsZero() {
+		return 0
 	}
+	return e.EndDateTime.Sub(e.DateTime)
+}
 
-	// Set the ID field of the user to the inserted ID
-	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
-		event.ID = oid
-	} else {
-		return nil, fmt.Errorf("failed to convert inserted ID to ObjectID")
+// ValidateSchedule checks the time zone and that the event ends after it
+// starts, and normalizes both times to UTC for storage. Events without an
+// end last defaultEventDuration.
+func (e *Event) ValidateSchedule() error {
+	if err := e.validateStart(); err != nil {
+		return err
+	}
+	if e.EndDateTime.IsZero() {
+		e.EndDateTime = e.DateTime.Add(defaultEventDuration)
+	}
+	if !e.EndDateTime.After(e.DateTime) {
+		return errors.New("Event end must be after its start")
 	}
 
-	return result, nil
+	e.DateTime = e.DateTime.UTC()
+	e.EndDateTime = e.EndDateTime.UTC()
+	return nil
 }
 
-// Get Events retrieves all events from the MongoDB database.
-func GetEvents() ([]Event, error) {
-	// Context to use for the operation.
-	ctx := context.Background()
+// validateStart checks the time zone and start of the event.
+func (e *Event) validateStart() error {
+	if e.TimeZone == "" {
+		e.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(e.TimeZone); err != nil {
+		return fmt.Errorf("Unknown time zone %q", e.TimeZone)
+	}
+	if e.DateTime.IsZero() {
+		return errors.New("Event start is required")
+	}
+	e.DateTime = e.DateTime.UTC()
+	return nil
+}
 
-	// Get a handle to the collection.
-	collection := db.GetDatabase().Collection("events")
+// notEnded restricts a filter to events that haven't ended at now. Events
+// stored before they had an end count as ended once they started.
+func notEnded(filter bson.M, now time.Time) bson.M {
+	filter["$or"] = []bson.M{
+		{"endDateTime": bson.M{"$gt": now}},
+		{"endDateTime": nil, "dateTime": bson.M{"$gt": now}},
+	}
+	return filter
+}
 
-	// Perform the query to find all events.
-	cursor, err := collection.Find(ctx, bson.M{})
+// setLocalTime fills in the schedule as seen in the event's time zone.
+func (e *Event) setLocalTime() {
+	zone := e.TimeZone
+	if zone == "" {
+		zone = "UTC"
+	}
+	loc, err := time.LoadLocation(zone)
 	if err != nil {
-		return nil, err // Other error occurred
+		loc = time.UTC
+		zone = "UTC"
 	}
-	defer cursor.Close(ctx)
 
-	var events []Event
-	for cursor.Next(ctx) {
-		var event Event
-		if err := cursor.Decode(&event); err != nil {
-			return nil, err // Error decoding event
-		}
+	e.Local = &EventLocalTime{
+		TimeZone: zone,
+		DateTime: e.DateTime.In(loc).Format(time.RFC3339),
+	}
+	if !e.EndDateTime.IsZero() {
+		e.Local.EndDateTime = e.EndDateTime.In(loc).Format(time.RFC3339)
+	}
+}
 
-		// Fetch user data for the event
-		userIdHex := event.UserID.Hex()
+// ApplyScheduleUpdate merges any schedule fields from a raw update into the
+// event, validates the result, and rewrites the update with parsed times.
+func ApplyScheduleUpdate(event *Event, updateData bson.M) error {
+	_, hasStart := updateData["dateTime"]
+	_, hasEnd := updateData["endDateTime"]
+	_, hasZone := updateData["timeZone"]
+	if !hasStart && !hasEnd && !hasZone {
+		return nil
+	}
 
-		// Fetch user data for the event
-		user, err := GetUserById(userIdHex)
+	if hasStart {
+		start, err := parseUpdateTime(updateData["dateTime"])
 		if err != nil {
-			return nil, err // Error fetching user data
+			return err
 		}
-		event.User = user
+		event.DateTime = start
+	}
+	if hasEnd {
+		end, err := parseUpdateTime(updateData["endDateTime"])
+		if err != nil {
+			return err
+		}
+		event.EndDateTime = end
+	}
+	if hasZone {
+		zone, ok := updateData["timeZone"].(string)
+		if !ok {
+			return errors.New("timeZone must be a string")
+		}
+		event.TimeZone = zone
+	}
 
-		events = append(events, event)
+	// Events stored before they had an end keep going without one until an
+	// end is given, there is nothing to check the start against
+	if event.EndDateTime.IsZero() && !hasEnd {
+		if err := event.validateStart(); err != nil {
+			return err
+		}
+		updateData["dateTime"] = event.DateTime
+		updateData["timeZone"] = event.TimeZone
+		return nil
 	}
 
-	// Check for any errors that may have occurred during iteration.
-	if err := cursor.Err(); err != nil {
+	if err := event.ValidateSchedule(); err != nil {
+		return err
+	}
+
+	updateData["dateTime"] = event.DateTime
+	updateData["endDateTime"] = event.EndDateTime
+	updateData["timeZone"] = event.TimeZone
+	return nil
+}
+
+// ApplyCoordinatesUpdate validates coordinates in a raw update and rewrites
+// them as a GeoPoint. A null value removes the coordinates.
+func ApplyCoordinatesUpdate(updateData bson.M) error {
+	value, ok := updateData["coordinates"]
+	if !ok || value == nil {
+		return nil
+	}
+
+	raw, err := bson.Marshal(bson.M{"point": value})
+	if err != nil {
+		return errors.New("Invalid coordinates")
+	}
+	var decoded struct {
+		Point GeoPoint `bson:"point"`
+	}
+	if err := bson.Unmarshal(raw, &decoded); err != nil {
+		return errors.New("Coordinates must be a GeoJSON Point")
+	}
+	if err := decoded.Point.Validate(); err != nil {
+		return err
+	}
+
+	updateData["coordinates"] = decoded.Point
+	return nil
+}
+
+func parseUpdateTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid time %q, expected RFC 3339", v)
+		}
+		return t, nil
+	}
+	return time.Time{}, errors.New("Invalid time value")
+}
+
+func InsertEvent(ctx context.Context, event *Event) (*mongo.InsertOneResult, error) {
+	event.Version = 0
+
+	collection := db.GetDatabase().Collection("events")
+	result, err := collection.InsertOne(ctx, event)
+	if err != nil {
 		return nil, err
 	}
 
-	return events, nil
+	// Set the ID field of the user to the inserted ID
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		event.ID = oid
+	} else {
+		return nil, fmt.Errorf("failed to convert inserted ID to ObjectID")
+	}
+	recordAudit(ctx, "events", AuditCreate, event.ID, nil, event)
+
+	return result, nil
+}
+
+// EventFilter narrows down GetEvents. Empty fields don't filter.
+type EventFilter struct {
+	Category string
+	Tag      string
+	ViewerID string // Drafts of this user are included
+}
+
+// Get Events retrieves all events from the MongoDB database.
+func GetEvents(eventFilter EventFilter) ([]Event, error) {
+	filter := bson.M{}
+	if eventFilter.Category != "" {
+		filter["category"] = eventFilter.Category
+	}
+	if eventFilter.Tag != "" {
+		filter["tags"] = eventFilter.Tag
+	}
+
+	return findEvents(visibleTo(filter, eventFilter.ViewerID))
 }
 
 func GetEventById(id string) (*Event, error) {
@@ -91,7 +268,7 @@ func GetEventById(id string) (*Event, error) {
 	}
 
 	// Specify the filter to find the event by ID.
-	filter := bson.M{"_id": objectID}
+	filter := notDeleted(bson.M{"_id": objectID})
 
 	// Specify options to configure the query.
 	opts := options.FindOne()
@@ -120,88 +297,138 @@ func GetEventById(id string) (*Event, error) {
 		return nil, err // Error fetching user data
 	}
 	event.User = user
+	event.setLocalTime()
 
 	return &event, nil
 }
 
-func UpdateEvent(id string, updateData bson.M) (*Event, error) {
+func UpdateEvent(ctx context.Context, id string, updateData bson.M) (*Event, error) {
+	return updateEvent(ctx, id, nil, updateData)
+}
+
+// UpdateEventAtVersion updates an event only if it is still at version, and
+// returns ErrVersionConflict when someone else changed it first.
+func UpdateEventAtVersion(ctx context.Context, id string, version int64, updateData bson.M) (*Event, error) {
+	return updateEvent(ctx, id, &version, updateData)
+}
+
+func updateEvent(ctx context.Context, id string, version *int64, updateData bson.M) (*Event, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, errors.New("Invalid event ID format")
 	}
 
-	filter := bson.M{"_id": objectID}
-
-	// Context to use for the operation.
-	ctx := context.Background()
+	// The version is only ever incremented
+	delete(updateData, "version")
 
-	// Get a handle to the collection.
-	collection := db.GetDatabase().Collection("events")
+	filter := notDeleted(bson.M{"_id": objectID})
+	if version != nil {
+		filter = atVersion(filter, *version)
+	}
 
 	// Specify the update
 	update := bson.M{"$set": updateData}
 
 	// Perform the update.
 	var updatedEvent Event
-	if err := collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedEvent); err != nil {
+	if err := updateOneAudited(ctx, "events", AuditUpdate, filter, update, &updatedEvent); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, nil // User not found
+			if version != nil {
+				existing, err := GetEventById(id)
+				if err != nil {
+					return nil, err
+				}
+				if existing != nil {
+					return nil, ErrVersionConflict
+				}
+			}
+			return nil, nil // Event not found
 		}
 		return nil, err // Other error occurred
 	}
 
+	updatedEvent.setLocalTime()
+
 	return &updatedEvent, nil
 }
 
-func DeleteEvent(id string) (*Event, error) {
+// DeleteEvent soft deletes an event together with its registrations. Both
+// get the same deletedAt, so restoring the event brings back exactly the
+// registrations deleted with it.
+func DeleteEvent(ctx context.Context, id string) (*Event, error) {
 	// Convert the id string to a MongoDB ObjectID
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, errors.New("Invalid event ID format")
 	}
 
-	// Specify the filter to find the user by ID.
-	filter := bson.M{"_id": objectID}
+	// Specify the filter to find the event by ID.
+	filter := notDeleted(bson.M{"_id": objectID})
+
+	deletedAt := time.Now().UTC()
+	update := bson.M{"$set": bson.M{"deletedAt": deletedAt}}
+
+	var event *Event
+	err = db.WithTransaction(ctx, func(ctx mongo.SessionContext) error {
+		// Perform the query.
+		var deleted Event
+		if err := updateOneAudited(ctx, "events", AuditDelete, filter, update, &deleted); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil // Event not found
+			}
+			return err // Other error occurred
+		}
+		event = &deleted
 
-	// Specify options to configure the query.
-	opts := options.FindOneAndDelete()
+		_, err := updateManyAudited(ctx, "registrations", AuditDelete, notDeleted(bson.M{"eventId": objectID}), update)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	// Context to use for the operation.
-	ctx := context.Background()
+	return event, nil
+}
 
-	// Get a handle to the collection.
-	collection := db.GetDatabase().Collection("events")
+func AvailableEvents() ([]Event, error) {
+	// Define the filter to only fetch events that are open for registration
+	filter := bson.M{"isAvailable": true}
 
-	// Perform the query.
-	var event Event
-	if err := collection.FindOneAndDelete(ctx, filter, opts).Decode(&event); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil // User not found
-		}
-		return nil, err // Other error occurred
+	return findEvents(visibleTo(filter, ""))
+}
+
+// HappeningNowEvents retrieves the events that have started and not yet ended.
+func HappeningNowEvents() ([]Event, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"dateTime":    bson.M{"$lte": now},
+		"endDateTime": bson.M{"$gt": now},
 	}
+	return findEvents(visibleTo(filter, ""), options.Find().SetSort(bson.D{{Key: "dateTime", Value: 1}}))
+}
 
-	return &event, nil
+// UpcomingEvents retrieves the events that haven't started yet, soonest first.
+func UpcomingEvents() ([]Event, error) {
+	filter := bson.M{"dateTime": bson.M{"$gt": time.Now().UTC()}}
+	return findEvents(visibleTo(filter, ""), options.Find().SetSort(bson.D{{Key: "dateTime", Value: 1}}))
 }
 
-func AvailableEvents() ([]Event, error) {
+// findEvents runs a query against the events collection and embeds the
+// organizer of every event found.
+func findEvents(filter bson.M, opts ...*options.FindOptions) ([]Event, error) {
 	// Context to use for the operation.
 	ctx := context.Background()
 
 	// Get a handle to the collection.
 	collection := db.GetDatabase().Collection("events")
 
-	// Define the filter to only fetch events where isAvailable is true
-	filter := bson.M{"isAvailable": true}
-
-	// Perform the query to find all events matching the filter.
-	cursor, err := collection.Find(ctx, filter)
+	cursor, err := collection.Find(ctx, notDeleted(filter), opts...)
 	if err != nil {
 		return nil, err // Other error occurred
 	}
 	defer cursor.Close(ctx)
 
-	var events []Event
+	events := []Event{}
 	for cursor.Next(ctx) {
 		var event Event
 		if err := cursor.Decode(&event); err != nil {
@@ -209,14 +436,12 @@ func AvailableEvents() ([]Event, error) {
 		}
 
 		// Fetch user data for the event
-		userIdHex := event.UserID.Hex()
-
-		// Fetch user data for the event
-		user, err := GetUserById(userIdHex)
+		user, err := GetUserById(event.UserID.Hex())
 		if err != nil {
 			return nil, err // Error fetching user data
 		}
 		event.User = user
+		event.setLocalTime()
 
 		events = append(events, event)
 	}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidateSchedule(t *testing.T) {
+	start := time.Date(2030, 5, 1, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		event   Event
+		wantEnd time.Time
+		wantErr bool
+	}{
+		{"start and end", Event{DateTime: start, EndDateTime: start.Add(3 * time.Hour)}, start.Add(3 * time.Hour), false},
+		{"no end", Event{DateTime: start}, start.Add(defaultEventDuration), false},
+		{"end before start", Event{DateTime: start, EndDateTime: start.Add(-time.Hour)}, time.Time{}, true},
+		{"end at start", Event{DateTime: start, EndDateTime: start}, time.Time{}, true},
+		{"no start", Event{EndDateTime: start}, time.Time{}, true},
+		{"unknown time zone", Event{DateTime: start, TimeZone: "Mars/Olympus"}, time.Time{}, true},
+	}
+	for _, test := range tests {
+		err := test.event.ValidateSchedule()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && !test.event.EndDateTime.Equal(test.wantEnd) {
+			t.Errorf("%s: end = %s, want %s", test.name, test.event.EndDateTime, test.wantEnd)
+		}
+	}
+}
+
+func TestApplyScheduleUpdate(t *testing.T) {
+	start := time.Date(2030, 5, 1, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		event   Event
+		update  bson.M
+		wantEnd interface{} // Value of endDateTime in the rewritten update
+		wantErr bool
+	}{
+		{
+			name:   "legacy event without end moves its start",
+			event:  Event{DateTime: start},
+			update: bson.M{"dateTime": start.Add(24 * time.Hour).Format(time.RFC3339)},
+		},
+		{
+			name:    "legacy event gets an end",
+			event:   Event{DateTime: start},
+			update:  bson.M{"endDateTime": start.Add(2 * time.Hour).Format(time.RFC3339)},
+			wantEnd: start.Add(2 * time.Hour),
+		},
+		{
+			name:    "start moved past the end",
+			event:   Event{DateTime: start, EndDateTime: start.Add(time.Hour)},
+			update:  bson.M{"dateTime": start.Add(2 * time.Hour).Format(time.RFC3339)},
+			wantErr: true,
+		},
+		{
+			name:    "end moved",
+			event:   Event{DateTime: start, EndDateTime: start.Add(time.Hour)},
+			update:  bson.M{"endDateTime": start.Add(90 * time.Minute).Format(time.RFC3339)},
+			wantEnd: start.Add(90 * time.Minute),
+		},
+		{
+			name:   "no schedule fields",
+			event:  Event{DateTime: start},
+			update: bson.M{"name": "Renamed"},
+		},
+	}
+	for _, test := range tests {
+		err := ApplyScheduleUpdate(&test.event, test.update)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		end, ok := test.update["endDateTime"]
+		if test.wantEnd == nil {
+			if ok {
+				t.Errorf("%s: update sets endDateTime to %v, want it unset", test.name, end)
+			}
+			continue
+		}
+		if endTime, _ := end.(time.Time); !endTime.Equal(test.wantEnd.(time.Time)) {
+			t.Errorf("%s: endDateTime = %v, want %v", test.name, end, test.wantEnd)
+		}
+	}
+}
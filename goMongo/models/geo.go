@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/goMongo/db"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GeoPoint is a GeoJSON point. Coordinates are [longitude, latitude], in
+// that order, as GeoJSON and MongoDB's 2dsphere index expect.
+type GeoPoint struct {
+	Type        string     `bson:"type" json:"type"`
+	Coordinates [2]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewGeoPoint builds a point from a latitude and longitude.
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: [2]float64{lng, lat}}
+}
+
+// Validate checks that the point is a GeoJSON Point within valid ranges.
+func (p *GeoPoint) Validate() error {
+	if p.Type == "" {
+		p.Type = "Point"
+	}
+	if p.Type != "Point" {
+		return errors.New("Coordinates must be a GeoJSON Point")
+	}
+	if lng, lat := p.Coordinates[0], p.Coordinates[1]; lng < -180 || lng > 180 || lat < -90 || lat > 90 {
+		return errors.New("Coordinates must be [longitude, latitude] within valid ranges")
+	}
+	return nil
+}
+
+// NearbySearch holds the parameters of an "events near me" query. Radius is
+// in meters; the other filters are optional.
+type NearbySearch struct {
+	Point       *GeoPoint
+	Radius      float64
+	IsAvailable *bool
+	From        time.Time
+	To          time.Time
+	Limit       int64
+}
+
+// EventDistance is an event with its distance in meters from the search point.
+type EventDistance struct {
+	Event    `bson:",inline"`
+	Distance float64 `bson:"distance" json:"distance"`
+}
+
+// NearbyEvents finds events with coordinates within the search radius,
+// closest first.
+func NearbyEvents(search NearbySearch) ([]EventDistance, error) {
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	// Get a handle to the collection.
+	collection := db.GetDatabase().Collection("events")
+
+	query := bson.M{}
+	if search.IsAvailable != nil {
+		query["isAvailable"] = *search.IsAvailable
+	}
+	if !search.From.IsZero() || !search.To.IsZero() {
+		dateRange := bson.M{}
+		if !search.From.IsZero() {
+			dateRange["$gte"] = search.From
+		}
+		if !search.To.IsZero() {
+			dateRange["$lt"] = search.To
+		}
+		query["dateTime"] = dateRange
+	}
+
+	// $geoNear has to be the first stage and already sorts by distance
+	pipeline := []bson.M{
+		{"$geoNear": bson.M{
+			"near":          search.Point,
+			"distanceField": "distance",
+			"maxDistance":   search.Radius,
+			"spherical":     true,
+			"key":           "coordinates",
+			"query":         visibleTo(notDeleted(query), ""),
+		}},
+		{"$limit": search.Limit},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []EventDistance{}
+	for cursor.Next(ctx) {
+		var event EventDistance
+		if err := cursor.Decode(&event); err != nil {
+			return nil, err // Error decoding event
+		}
+
+		// Fetch user data for the event
+		user, err := GetUserById(event.UserID.Hex())
+		if err != nil {
+			return nil, err // Error fetching user data
+		}
+		event.User = user
+		event.setLocalTime()
+
+		events = append(events, event)
+	}
+
+	// Check for any errors that may have occurred during iteration.
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"example.com/goMongo/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IdempotencyRecord holds the first response to a request sent with an
+// Idempotency-Key, so retries of the request get the same response instead
+// of repeating its side effects. Records expire through a TTL index.
+type IdempotencyRecord struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	UserID      string             `bson:"userId"` // Empty for anonymous requests such as sign up
+	Key         string             `bson:"key"`
+	Route       string             `bson:"route"`                // Method and path the key was used on
+	RequestHash string             `bson:"requestHash"`          // SHA-256 of the request body
+	StatusCode  int                `bson:"statusCode,omitempty"` // Unset while the first request is running
+	ContentType string             `bson:"contentType,omitempty"`
+	Body        []byte             `bson:"body,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt"`
+	ExpiresAt   time.Time          `bson:"expiresAt"`
+}
+
+// IsComplete reports whether the response of the first request is stored.
+func (r *IdempotencyRecord) IsComplete() bool {
+	return r.StatusCode != 0
+}
+
+// BeginIdempotentRequest claims a key for a request. When the key is new it
+// returns the claimed record and true. When the key was used before it
+// returns the earlier record and false, and the caller replays or rejects.
+func BeginIdempotentRequest(userId, key, route, requestHash string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	ctx := context.Background()
+	collection := db.GetDatabase().Collection("idempotency")
+	filter := bson.M{"userId": userId, "key": key, "route": route}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now().UTC()
+		record := IdempotencyRecord{
+			ID:          primitive.NewObjectID(),
+			UserID:      userId,
+			Key:         key,
+			Route:       route,
+			RequestHash: requestHash,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		}
+		_, err := collection.InsertOne(ctx, record)
+		if err == nil {
+			return &record, true, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, false, err
+		}
+
+		var existing IdempotencyRecord
+		if err := collection.FindOne(ctx, filter).Decode(&existing); err != nil {
+			if err == mongo.ErrNoDocuments {
+				continue // Expired and removed in the meantime
+			}
+			return nil, false, err
+		}
+		if existing.ExpiresAt.After(now) {
+			return &existing, false, nil
+		}
+
+		// The TTL monitor only runs once a minute, so drop the expired
+		// record here and claim the key again
+		if _, err := collection.DeleteOne(ctx, bson.M{"_id": existing.ID}); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return nil, false, mongo.ErrNoDocuments
+}
+
+// CompleteIdempotentRequest stores the response of a claimed request.
+func CompleteIdempotentRequest(id primitive.ObjectID, statusCode int, contentType string, body []byte) error {
+	collection := db.GetDatabase().Collection("idempotency")
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"statusCode":  statusCode,
+		"contentType": contentType,
+		"body":        body,
+	}})
+	return err
+}
+
+// ReleaseIdempotentRequest gives up a claimed key, so a request that failed
+// on the server side can be retried with it.
+func ReleaseIdempotentRequest(id primitive.ObjectID) error {
+	collection := db.GetDatabase().Collection("idempotency")
+	_, err := collection.DeleteOne(context.Background(), bson.M{"_id": id})
+	return err
+}
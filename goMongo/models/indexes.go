@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+
+	"example.com/goMongo/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes the models rely on. Creating an index
+// that already exists is a no-op, so this is safe to run on every start.
+func EnsureIndexes() error {
+	ctx := context.Background()
+	database := db.GetDatabase()
+
+	indexes := map[string][]mongo.IndexModel{
+		"events": {
+			{
+				// Full-text search over the descriptive fields of an event
+				Keys: bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}, {Key: "location", Value: "text"}},
+				Options: options.Index().
+					SetName("event_text").
+					SetWeights(bson.M{"name": 10, "location": 5, "description": 1}),
+			},
+			{Keys: bson.D{{Key: "location", Value: 1}}},
+			{Keys: bson.D{{Key: "coordinates", Value: "2dsphere"}}},
+			{Keys: bson.D{{Key: "category", Value: 1}}},
+			{Keys: bson.D{{Key: "tags", Value: 1}}},
+			{Keys: bson.D{{Key: "dateTime", Value: 1}}},
+			{Keys: bson.D{{Key: "venueId", Value: 1}, {Key: "dateTime", Value: 1}}},
+			{
+				// One materialized event per occurrence of a series
+				Keys: bson.D{{Key: "seriesId", Value: 1}, {Key: "occurrenceStart", Value: 1}},
+				Options: options.Index().
+					SetUnique(true).
+					SetPartialFilterExpression(bson.M{"seriesId": bson.M{"$exists": true}}),
+			},
+		},
+		"users": {
+			{
+				// An external account logs in as one user only
+				Keys: bson.D{{Key: "identities.issuer", Value: 1}, {Key: "identities.subject", Value: 1}},
+				Options: options.Index().
+					SetUnique(true).
+					SetPartialFilterExpression(bson.M{"identities": bson.M{"$exists": true}}),
+			},
+		},
+		"oidcStates": {
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		"apiKeys": {
+			{Keys: bson.D{{Key: "keyHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		},
+		"sessions": {
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		"passwordResets": {
+			{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		"categories": {
+			{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		// Also creates the collection up front, which audit entries written
+		// inside transactions need on older MongoDB versions
+		"audit": {
+			{Keys: bson.D{{Key: "timestamp", Value: -1}}},
+			{Keys: bson.D{{Key: "collection", Value: 1}, {Key: "documentId", Value: 1}, {Key: "timestamp", Value: -1}}},
+			{Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "timestamp", Value: -1}}},
+			{Keys: bson.D{{Key: "requestId", Value: 1}}},
+		},
+		"rateLimits": {
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		"loginFailures": {
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		"idempotency": {
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "key", Value: 1}, {Key: "route", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := database.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"example.com/goMongo/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Number of recovery codes handed out when MFA is turned on
+const recoveryCodeCount = 10
+
+var (
+	ErrMFAEnabled     = errors.New("Two-factor authentication is already enabled")
+	ErrMFANotEnabled  = errors.New("Two-factor authentication is not enabled")
+	ErrMFANotEnrolled = errors.New("Start two-factor enrollment first")
+	ErrInvalidMFACode = errors.New("Invalid two-factor code")
+)
+
+var totpCodePattern = regexp.MustCompile(`^[0-9]{6}$`)
+
+// UserMFA is the TOTP two-factor setup of a user. Only whether it is enabled
+// ever leaves the server.
+type UserMFA struct {
+	Secret        string     `bson:"secret" json:"-"`                  // Encrypted with utils.EncryptSecret
+	Enabled       bool       `bson:"enabled" json:"enabled"`           // False until the first code is confirmed
+	RecoveryCodes []string   `bson:"recoveryCodes,omitempty" json:"-"` // Hashed with utils.HashRecoveryCode
+	LastStep      int64      `bson:"lastStep,omitempty" json:"-"`      // Last accepted time step, so codes can't be replayed
+	EnabledAt     *time.Time `bson:"enabledAt,omitempty" json:"enabledAt,omitempty"`
+}
+
+// IsMFAEnabled reports whether logging in needs a second factor.
+func (u *User) IsMFAEnabled() bool {
+	return u.MFA != nil && u.MFA.Enabled
+}
+
+// BeginMFAEnrollment stores a new, not yet enabled TOTP secret for the user
+// and returns it. Enrolling again before confirming replaces the secret.
+func BeginMFAEnrollment(ctx context.Context, user *User) (string, error) {
+	if user.IsMFAEnabled() {
+		return "", ErrMFAEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := utils.EncryptSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	filter := notDeleted(bson.M{"_id": user.ID, "mfa.enabled": bson.M{"$ne": true}})
+	update := bson.M{"$set": bson.M{"mfa": UserMFA{Secret: encrypted}}}
+	if err := updateOneAudited(ctx, "users", AuditUpdate, filter, update, user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", ErrMFAEnabled
+		}
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// ConfirmMFAEnrollment enables MFA once the user proves their authenticator
+// produces valid codes, and returns the recovery codes. They are only stored
+// hashed, so this is the one time they can be shown.
+func ConfirmMFAEnrollment(ctx context.Context, user *User, code string) ([]string, error) {
+	if user.IsMFAEnabled() {
+		return nil, ErrMFAEnabled
+	}
+	if user.MFA == nil {
+		return nil, ErrMFANotEnrolled
+	}
+
+	secret, err := utils.DecryptSecret(user.MFA.Secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+
+	now := time.Now().UTC()
+	filter := notDeleted(bson.M{"_id": user.ID, "mfa.secret": user.MFA.Secret, "mfa.enabled": false})
+	update := bson.M{"$set": bson.M{
+		"mfa.enabled":       true,
+		"mfa.recoveryCodes": hashes,
+		"mfa.lastStep":      step,
+		"mfa.enabledAt":     now,
+	}}
+	if err := updateOneAudited(ctx, "users", AuditUpdate, filter, update, user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrMFANotEnrolled // Enrolled again in the meantime
+		}
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyMFA checks the second factor of a user, which is either a code from
+// their authenticator or one of their recovery codes. Each authenticator
+// code and each recovery code is only accepted once.
+func VerifyMFA(ctx context.Context, user *User, code string) error {
+	if !user.IsMFAEnabled() {
+		return ErrMFANotEnabled
+	}
+
+	if !totpCodePattern.MatchString(code) {
+		// Using up a recovery code is worth an audit entry
+		filter := notDeleted(bson.M{"_id": user.ID, "mfa.recoveryCodes": utils.HashRecoveryCode(code)})
+		update := bson.M{"$pull": bson.M{"mfa.recoveryCodes": utils.HashRecoveryCode(code)}}
+		if err := updateOneAudited(ctx, "users", AuditUpdate, filter, update, user); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrInvalidMFACode
+			}
+			return err
+		}
+		return nil
+	}
+
+	secret, err := utils.DecryptSecret(user.MFA.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	// Moving lastStep forward only succeeds once per step
+	filter := notDeleted(bson.M{"_id": user.ID, "mfa.lastStep": bson.M{"$not": bson.M{"$gte": step}}})
+	update := bson.M{"$set": bson.M{"mfa.lastStep": step}}
+	if err := updateOneAudited(ctx, "users", AuditUpdate, filter, update, user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+	return nil
+}
+
+// DisableMFA turns MFA off after checking a current code.
+func DisableMFA(ctx context.Context, user *User, code string) error {
+	if err := VerifyMFA(ctx, user, code); err != nil {
+		return err
+	}
+
+	update := bson.M{"$unset": bson.M{"mfa": ""}}
+	if err := updateOneAudited(ctx, "users", AuditUpdate, notDeleted(bson.M{"_id": user.ID}), update, user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrMFANotEnabled
+		}
+		return err
+	}
+	return nil
+}
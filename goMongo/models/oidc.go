@@ -0,0 +1,169 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"example.com/goMongo/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidOIDCState = errors.New("Login expired or was started elsewhere, try again")
+	ErrUnverifiedEmail  = errors.New("The provider hasn't verified your email address")
+	// ErrOIDCLinkRequired is returned when an identity's email belongs to an
+	// account whose address wasn't verified, so it isn't linked by itself.
+	ErrOIDCLinkRequired = errors.New("An account with this email address exists, log in with its password and link the provider from there")
+	// ErrIdentityLinked is returned when linking an identity that already
+	// logs in as another user.
+	ErrIdentityLinked = errors.New("This account at the provider is linked to another user")
+)
+
+// ExternalIdentity is an account at an OIDC provider a user can log in with.
+// The subject is only unique per issuer, so both identify the account.
+type ExternalIdentity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Issuer   string    `bson:"issuer" json:"issuer"`
+	Subject  string    `bson:"subject" json:"-"`
+	Email    string    `bson:"email,omitempty" json:"email,omitempty"`
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
+
+// OIDCState is a login in progress at an OIDC provider, stored until the
+// provider redirects back. The code verifier never leaves the server.
+// States expire through a TTL index.
+type OIDCState struct {
+	State        string             `bson:"_id"`
+	Provider     string             `bson:"provider"`
+	Nonce        string             `bson:"nonce"`
+	CodeVerifier string             `bson:"codeVerifier"`
+	LinkUserID   primitive.ObjectID `bson:"linkUserId,omitempty"` // Set when a signed in user links the provider
+	ExpiresAt    time.Time          `bson:"expiresAt"`
+}
+
+// SaveOIDCState stores a login that was just sent to the provider.
+func SaveOIDCState(state *OIDCState) error {
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	collection := db.GetDatabase().Collection("oidcStates")
+	_, err := collection.InsertOne(ctx, state)
+	return err
+}
+
+// TakeOIDCState removes and returns the login started with state, so each
+// authorization response is only accepted once.
+func TakeOIDCState(state, provider string) (*OIDCState, error) {
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	collection := db.GetDatabase().Collection("oidcStates")
+	var stored OIDCState
+	if err := collection.FindOneAndDelete(ctx, bson.M{"_id": state}).Decode(&stored); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+
+	// The TTL monitor only runs once a minute
+	if stored.Provider != provider || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+	return &stored, nil
+}
+
+// FindOrLinkOIDCUser returns the user an identity from an OIDC provider
+// logs in as. Known identities log in as the user they are linked to.
+// Otherwise the identity is linked to the user with the same email address,
+// or a new user without a password is created for it. Both only happen when
+// the provider verified the address, otherwise anybody could take over an
+// account by registering its address at the provider. Linking also needs
+// the user to have verified the address with us: whoever signed up with an
+// address they don't own mustn't end up sharing the account with its owner.
+// Those users link the provider themselves with LinkOIDCIdentity.
+func FindOrLinkOIDCUser(ctx context.Context, identity ExternalIdentity, name string, emailVerified bool) (*User, error) {
+	collection := db.GetDatabase().Collection("users")
+
+	var user User
+	filter := notDeleted(bson.M{"identities": bson.M{"$elemMatch": bson.M{"issuer": identity.Issuer, "subject": identity.Subject}}})
+	err := collection.FindOne(ctx, filter).Decode(&user)
+	if err == nil {
+		return &user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	if !emailVerified || identity.Email == "" {
+		return nil, ErrUnverifiedEmail
+	}
+	identity.LinkedAt = time.Now().UTC()
+
+	filter = notDeleted(bson.M{"email": identity.Email, "emailVerified": true})
+	update := bson.M{"$push": bson.M{"identities": identity}}
+	err = updateOneAudited(ctx, "users", AuditUpdate, filter, update, &user)
+	if err == nil {
+		return &user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if emailExists(identity.Email) {
+		return nil, ErrOIDCLinkRequired
+	}
+
+	if strings.TrimSpace(name) == "" {
+		name = identity.Email
+	}
+	user = User{
+		ID:            primitive.NewObjectID(),
+		Name:          name,
+		Email:         identity.Email,
+		EmailVerified: true, // Verified by the provider
+		Password:      "",   // No password until the user sets one, so only the provider logs in
+		Role:          RoleUser,
+		Identities:    []ExternalIdentity{identity},
+	}
+	if _, err := collection.InsertOne(ctx, user); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, "users", AuditCreate, user.ID, nil, user)
+
+	return &user, nil
+}
+
+// LinkOIDCIdentity links an identity from an OIDC provider to a signed in
+// user, who can log in through the provider from then on.
+func LinkOIDCIdentity(ctx context.Context, userId primitive.ObjectID, identity ExternalIdentity) (*User, error) {
+	collection := db.GetDatabase().Collection("users")
+
+	match := bson.M{"$elemMatch": bson.M{"issuer": identity.Issuer, "subject": identity.Subject}}
+	var owner User
+	err := collection.FindOne(ctx, notDeleted(bson.M{"identities": match})).Decode(&owner)
+	if err == nil {
+		if owner.ID != userId {
+			return nil, ErrIdentityLinked
+		}
+		return &owner, nil // Linked before
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	identity.LinkedAt = time.Now().UTC()
+	var user User
+	filter := notDeleted(bson.M{"_id": userId})
+	update := bson.M{"$push": bson.M{"identities": identity}}
+	if err := updateOneAudited(ctx, "users", AuditUpdate, filter, update, &user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // User not found
+		}
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"example.com/goMongo/db"
+	"example.com/goMongo/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// How long a password reset link works
+const passwordResetTTL = time.Hour
+
+var (
+	ErrWrongPassword     = errors.New("Current password is wrong")
+	ErrInvalidResetToken = errors.New("Invalid or expired password reset token")
+)
+
+// PasswordReset is a pending password reset. Only a hash of the token that
+// was sent to the user is stored, and resets expire through a TTL index.
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	Email     string             `bson:"email"` // Address the token was sent to
+	TokenHash string             `bson:"tokenHash"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+}
+
+// setPassword checks a new password against the policy and stores its hash.
+func setPassword(ctx context.Context, user *User, password string) error {
+	if err := utils.ValidatePassword(password, user.Email); err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"password": hashedPassword}}
+	return updateOneAudited(ctx, "users", AuditUpdate, notDeleted(bson.M{"_id": user.ID}), update, user)
+}
+
+// ChangePassword changes the password of a signed in user after checking
+// their current one. Users who only ever logged in through an OIDC provider
+// have none yet and set their first without.
+func ChangePassword(ctx context.Context, user *User, currentPassword, newPassword string) error {
+	if user.Password != "" && !utils.CheckPassword(currentPassword, user.Password) {
+		return ErrWrongPassword
+	}
+	return setPassword(ctx, user, newPassword)
+}
+
+// RequestPasswordReset sends a password reset token to the user with email.
+// Unknown addresses are ignored without an error, so the endpoint can't be
+// used to find out who has an account.
+func RequestPasswordReset(ctx context.Context, email string) error {
+	collection := db.GetDatabase().Collection("users")
+	var user User
+	if err := collection.FindOne(ctx, notDeleted(bson.M{"email": email})).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+
+	token, err := utils.RandomString(32)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	reset := PasswordReset{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetTTL),
+	}
+	if _, err := db.GetDatabase().Collection("passwordResets").InsertOne(ctx, reset); err != nil {
+		return err
+	}
+
+	err = utils.Notify(utils.Notification{
+		UserID:  user.ID.Hex(),
+		Email:   user.Email,
+		Name:    user.Name,
+		Subject: "Reset your password",
+		Body:    "Use this token within an hour to choose a new password: " + token + "\nIf you didn't ask for it, ignore this message.",
+	})
+	if err != nil {
+		log.Println("Failed to send password reset to user", user.ID.Hex(), ":", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset
+// and returns the user. Tokens only work once, and every other pending
+// reset of the user is dropped with it.
+func ResetPassword(ctx context.Context, token, newPassword string) (*User, error) {
+	collection := db.GetDatabase().Collection("passwordResets")
+
+	var reset PasswordReset
+	err := collection.FindOne(ctx, bson.M{"tokenHash": hashToken(token)}).Decode(&reset)
+	if err == mongo.ErrNoDocuments || err == nil && time.Now().After(reset.ExpiresAt) {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := GetUserById(reset.UserID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidResetToken
+	}
+
+	// Check the policy before using up the token, so a rejected password
+	// can be corrected
+	if err := utils.ValidatePassword(newPassword, user.Email); err != nil {
+		return nil, err
+	}
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": reset.ID})
+	if err != nil {
+		return nil, err
+	}
+	if result.DeletedCount == 0 {
+		return nil, ErrInvalidResetToken // Used concurrently
+	}
+
+	if err := setPassword(ctx, user, newPassword); err != nil {
+		return nil, err
+	}
+	if _, err := collection.DeleteMany(ctx, bson.M{"userId": user.ID}); err != nil {
+		return nil, err
+	}
+
+	// Using the token proves the user receives mail at the address it was
+	// sent to, as long as that is still their address
+	if !user.EmailVerified && reset.Email != "" && reset.Email == user.Email {
+		filter := notDeleted(bson.M{"_id": user.ID, "email": reset.Email})
+		update := bson.M{"$set": bson.M{"emailVerified": true}}
+		if err := updateOneAudited(ctx, "users", AuditUpdate, filter, update, user); err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+	return user, nil
+}
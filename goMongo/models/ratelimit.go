@@ -0,0 +1,113 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"example.com/goMongo/db"
+	"example.com/goMongo/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoLimiterStore keeps rate limit and lockout state in MongoDB, so every
+// instance of the server shares the same limits. Documents expire through
+// TTL indexes once they no longer matter.
+type MongoLimiterStore struct{}
+
+// Take refills and takes from the bucket in one pipeline update, so
+// concurrent requests can't take the same token.
+func (MongoLimiterStore) Take(key string, limit utils.RateLimit, now time.Time) (bool, time.Duration, error) {
+	burst := float64(limit.Burst)
+	elapsed := bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updatedAt", now}}}}, 1000}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$tokens", burst}},
+				bson.M{"$multiply": bson.A{elapsed, limit.Rate}},
+			}}}},
+			"updatedAt": now,
+		}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":    bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"expiresAt": now.Add(time.Duration(burst / limit.Rate * float64(time.Second))),
+		}}},
+	}
+
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := db.GetDatabase().Collection("rateLimits").FindOneAndUpdate(context.Background(), bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+	if err != nil {
+		return false, 0, err
+	}
+	if !bucket.Allowed {
+		return false, utils.RetryAfter(bucket.Tokens, limit), nil
+	}
+	return true, 0, nil
+}
+
+func (MongoLimiterStore) Fail(key string, policy utils.LockoutPolicy, now time.Time) (time.Time, error) {
+	ctx := context.Background()
+	collection := db.GetDatabase().Collection("loginFailures")
+
+	// Failures further apart than the window start counting from one again
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$lockedUntil", now}},
+				"$failures",
+				bson.M{"$cond": bson.A{
+					bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$lastFailure", time.Time{}}}, now.Add(-policy.Window)}},
+					bson.M{"$add": bson.A{"$failures", 1}},
+					1,
+				}},
+			}},
+			"lastFailure": now,
+			"expiresAt":   now.Add(policy.Window + policy.Duration),
+		}}},
+	}
+
+	var state struct {
+		Failures    int       `bson:"failures"`
+		LockedUntil time.Time `bson:"lockedUntil"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&state); err != nil {
+		return time.Time{}, err
+	}
+	if state.LockedUntil.After(now) {
+		return state.LockedUntil, nil
+	}
+	if state.Failures < policy.MaxFailures {
+		return time.Time{}, nil
+	}
+
+	lockedUntil := now.Add(policy.Duration)
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{
+		"failures":    0,
+		"lockedUntil": lockedUntil,
+		"expiresAt":   lockedUntil,
+	}})
+	return lockedUntil, err
+}
+
+func (MongoLimiterStore) LockedUntil(key string, now time.Time) (time.Time, error) {
+	var state struct {
+		LockedUntil time.Time `bson:"lockedUntil"`
+	}
+	err := db.GetDatabase().Collection("loginFailures").FindOne(context.Background(), bson.M{"_id": key}).Decode(&state)
+	if err == mongo.ErrNoDocuments || err == nil && !state.LockedUntil.After(now) {
+		return time.Time{}, nil
+	}
+	return state.LockedUntil, err
+}
+
+func (MongoLimiterStore) Reset(key string) error {
+	_, err := db.GetDatabase().Collection("loginFailures").DeleteOne(context.Background(), bson.M{"_id": key})
+	return err
+}
@@ -4,25 +4,113 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"example.com/goMongo/db"
+	"example.com/goMongo/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Registration statuses
+const (
+	RegistrationStatusRegistered = "registered"
+	RegistrationStatusAttended   = "attended"
+	RegistrationStatusCancelled  = "cancelled"
+)
+
+var (
+	// ErrAlreadyCheckedIn is returned when a ticket is scanned a second time.
+	ErrAlreadyCheckedIn = errors.New("Ticket has already been used")
+	// ErrAlreadyRegistered is returned when a user registers for an event twice.
+	ErrAlreadyRegistered = errors.New("Already registered for this event")
+	// ErrRegistrationAttended is returned when cancelling a registration
+	// whose ticket was already scanned.
+	ErrRegistrationAttended = errors.New("Attended registrations can't be cancelled")
+	// ErrEventFull is returned when an event's capacity is taken.
+	ErrEventFull = errors.New("Event is full")
+)
+
 type Registration struct {
-	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	EventID primitive.ObjectID `bson:"eventId" json:"eventId"`
-	UserID  primitive.ObjectID `bson:"userId" json:"userId"`
-	Event   *Event             `bson:"-" json:"event"`
-	User    *User              `bson:"-" json:"user"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	EventID     primitive.ObjectID `bson:"eventId" json:"eventId"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
+	Status      string             `bson:"status" json:"status"`
+	TicketCode  string             `bson:"ticketCode" json:"ticketCode"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	CheckedInAt *time.Time         `bson:"checkedInAt,omitempty" json:"checkedInAt,omitempty"`
+	DeletedAt   *time.Time         `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	Anonymized  bool               `bson:"anonymized,omitempty" json:"anonymized,omitempty"` // The user was deleted
+	Event       *Event             `bson:"-" json:"event"`
+	User        *User              `bson:"-" json:"user"`
 }
 
-func RegisterEvent(registration *Registration) (*mongo.InsertOneResult, error) {
+// RegisterEvent registers a user for an event, and closes the event once
+// its capacity is taken. A registration the user cancelled before is
+// registered again rather than duplicated, so it keeps its ID and ticket.
+func RegisterEvent(ctx context.Context, registration *Registration) (*mongo.InsertOneResult, error) {
+	result, err := insertRegistration(ctx, registration)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := GetEventById(registration.EventID.Hex())
+	if err != nil || event == nil {
+		return result, err
+	}
+	active, err := countActiveRegistrations(ctx, event.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Registrations racing for the last places all counted each other, the
+	// one that went over gives its place back
+	if event.Capacity > 0 && active > int64(event.Capacity) {
+		filter := bson.M{"_id": registration.ID}
+		update := bson.M{"$set": bson.M{"status": RegistrationStatusCancelled}}
+		if err := updateOneAudited(ctx, "registrations", AuditUpdate, filter, update, nil); err != nil {
+			return nil, err
+		}
+		return nil, ErrEventFull
+	}
+
+	if err := setEventAvailability(ctx, event, active); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func insertRegistration(ctx context.Context, registration *Registration) (*mongo.InsertOneResult, error) {
 	collection := db.GetDatabase().Collection("registrations")
-	result, err := collection.InsertOne(context.TODO(), registration)
+
+	var existing Registration
+	err := collection.FindOne(ctx, notDeleted(bson.M{"eventId": registration.EventID, "userId": registration.UserID})).Decode(&existing)
+	if err == nil {
+		if existing.Status != RegistrationStatusCancelled {
+			return nil, ErrAlreadyRegistered
+		}
+		return reactivateRegistration(ctx, &existing, registration)
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	if registration.Status == "" {
+		registration.Status = RegistrationStatusRegistered
+	}
+	if registration.CreatedAt.IsZero() {
+		registration.CreatedAt = time.Now().UTC()
+	}
+
+	// The ticket code signs the registration ID, so the ID is assigned up front
+	if registration.ID.IsZero() {
+		registration.ID = primitive.NewObjectID()
+	}
+	registration.TicketCode = utils.GenerateTicketCode(registration.ID, registration.EventID)
+
+	result, err := collection.InsertOne(ctx, registration)
 	if err != nil {
 		return nil, err
 	}
@@ -33,10 +121,30 @@ func RegisterEvent(registration *Registration) (*mongo.InsertOneResult, error) {
 	} else {
 		return nil, fmt.Errorf("failed to convert inserted ID to ObjectID")
 	}
+	recordAudit(ctx, "registrations", AuditCreate, registration.ID, nil, registration)
 
 	return result, nil
 }
 
+// reactivateRegistration switches a cancelled registration back to
+// registered and decodes it into registration. A ticket that was scanned
+// before it was cancelled stays used, so it can't be scanned a second time.
+func reactivateRegistration(ctx context.Context, cancelled, registration *Registration) (*mongo.InsertOneResult, error) {
+	status := RegistrationStatusRegistered
+	if cancelled.CheckedInAt != nil {
+		status = RegistrationStatusAttended
+	}
+	filter := notDeleted(bson.M{"_id": cancelled.ID, "status": RegistrationStatusCancelled})
+	update := bson.M{"$set": bson.M{"status": status}}
+	if err := updateOneAudited(ctx, "registrations", AuditUpdate, filter, update, registration); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrAlreadyRegistered // Registered again concurrently
+		}
+		return nil, err
+	}
+	return &mongo.InsertOneResult{InsertedID: registration.ID}, nil
+}
+
 func RegisteredEvents(userIdStr string) ([]Registration, error) {
 	// Convert the userIdStr to primitive.ObjectID
 	userIdObj, err := primitive.ObjectIDFromHex(userIdStr)
@@ -51,7 +159,7 @@ func RegisteredEvents(userIdStr string) ([]Registration, error) {
 	collection := db.GetDatabase().Collection("registrations")
 
 	// Define the filter to only fetch registrations for the logged-in user
-	filter := bson.M{"userId": userIdObj}
+	filter := notDeleted(bson.M{"userId": userIdObj})
 
 	cursor, err := collection.Find(ctx, filter)
 	if err != nil {
@@ -87,29 +195,235 @@ func RegisteredEvents(userIdStr string) ([]Registration, error) {
 	return registrations, nil
 }
 
-func CancelRegistration(id string) (*Registration, error) {
+// GetRegistrationById retrieves a registration from the MongoDB database by ID.
+func GetRegistrationById(id string) (*Registration, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, errors.New("Invalid registration ID format")
 	}
 
-	filter := bson.M{"_id": objectID}
-
-	opts := options.FindOneAndDelete()
-
 	ctx := context.Background()
 
 	collection := db.GetDatabase().Collection("registrations")
 
-	var register Registration
-
-	if err := collection.FindOneAndDelete(ctx, filter, opts).Decode(&register); err != nil {
+	var registration Registration
+	if err := collection.FindOne(ctx, notDeleted(bson.M{"_id": objectID})).Decode(&registration); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, nil // User not found
+			return nil, nil // Registration not found
 		}
 		return nil, err // Other error occurred
 	}
 
+	return &registration, nil
+}
+
+// CheckInRegistration marks a registration as attended. The status is
+// switched in a single atomic update so a ticket can only be used once.
+func CheckInRegistration(ctx context.Context, registrationId, eventId primitive.ObjectID) (*Registration, error) {
+	filter := notDeleted(bson.M{
+		"_id":     registrationId,
+		"eventId": eventId,
+		"status":  RegistrationStatusRegistered,
+	})
+	update := bson.M{"$set": bson.M{
+		"status":      RegistrationStatusAttended,
+		"checkedInAt": time.Now().UTC(),
+	}}
+
+	var registration Registration
+	err := updateOneAudited(ctx, "registrations", AuditUpdate, filter, update, &registration)
+	if err == nil {
+		return &registration, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	// Work out why the update didn't match
+	existing, err := GetRegistrationById(registrationId.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil || existing.EventID != eventId {
+		return nil, nil // Registration not found
+	}
+	if existing.Status == RegistrationStatusAttended {
+		return nil, ErrAlreadyCheckedIn
+	}
+	return nil, fmt.Errorf("Registration is %s", existing.Status)
+}
+
+// CancelRegistration marks a registration as cancelled. The document is kept
+// so calendar feeds can tell subscribers the registration was withdrawn.
+// Registrations that were checked in can't be cancelled.
+func CancelRegistration(ctx context.Context, id string) (*Registration, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("Invalid registration ID format")
+	}
+
+	filter := notDeleted(bson.M{
+		"_id":         objectID,
+		"status":      bson.M{"$ne": RegistrationStatusAttended},
+		"checkedInAt": bson.M{"$exists": false},
+	})
+
+	update := bson.M{"$set": bson.M{"status": RegistrationStatusCancelled}}
+
+	var register Registration
+
+	if err := updateOneAudited(ctx, "registrations", AuditUpdate, filter, update, &register); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, err // Other error occurred
+		}
+		existing, err := GetRegistrationById(id)
+		if err != nil || existing == nil {
+			return nil, err // Registration not found
+		}
+		return nil, ErrRegistrationAttended
+	}
+
+	// The event takes registrations again once a place is free
+	event, err := GetEventById(register.EventID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if event != nil {
+		if err := SyncEventAvailability(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+
 	return &register, nil
 
 }
+
+// SyncEventAvailability opens or closes an event for registration by
+// whether its active registrations fill its capacity, and updates event.
+// Events without a capacity take any number of registrations. Cancelled and
+// completed events stay closed.
+func SyncEventAvailability(ctx context.Context, event *Event) error {
+	active, err := countActiveRegistrations(ctx, event.ID)
+	if err != nil {
+		return err
+	}
+	return setEventAvailability(ctx, event, active)
+}
+
+func setEventAvailability(ctx context.Context, event *Event, active int64) error {
+	available := event.Capacity == 0 || active < int64(event.Capacity)
+	filter := notDeleted(bson.M{
+		"_id":         event.ID,
+		"isAvailable": !available,
+		"status":      bson.M{"$in": []interface{}{nil, EventStatusPublished, EventStatusDraft}},
+	})
+	err := updateOneAudited(ctx, "events", AuditUpdate, filter, bson.M{"$set": bson.M{"isAvailable": available}}, event)
+	if err == mongo.ErrNoDocuments {
+		return nil // Already right, or not open to registrations
+	}
+	return err
+}
+
+func countActiveRegistrations(ctx context.Context, eventId primitive.ObjectID) (int64, error) {
+	return db.GetDatabase().Collection("registrations").CountDocuments(ctx, notDeleted(bson.M{
+		"eventId": eventId,
+		"status":  bson.M{"$ne": RegistrationStatusCancelled},
+	}))
+}
+
+// EventRegistrations retrieves one page of the registrations for an event,
+// oldest first, together with the total number of registrations.
+func EventRegistrations(eventIdStr string, page, limit int64) ([]Registration, int64, error) {
+	eventIdObj, err := primitive.ObjectIDFromHex(eventIdStr)
+	if err != nil {
+		return nil, 0, errors.New("Invalid event ID format")
+	}
+
+	// Context to use for the operation
+	ctx := context.Background()
+
+	// Get a handle to the collection
+	collection := db.GetDatabase().Collection("registrations")
+
+	filter := notDeleted(bson.M{"eventId": eventIdObj})
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err // Other error occurred
+	}
+	defer cursor.Close(ctx)
+
+	registrations := []Registration{}
+	for cursor.Next(ctx) {
+		var registration Registration
+		if err := cursor.Decode(&registration); err != nil {
+			return nil, 0, err // Error decoding registration
+		}
+
+		// Fetch attendee data for the registration
+		user, err := GetUserById(registration.UserID.Hex())
+		if err != nil {
+			return nil, 0, err // Error fetching user data
+		}
+		registration.User = user
+
+		registrations = append(registrations, registration)
+	}
+
+	// Check for any errors that may have occurred during iteration.
+	if err := cursor.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return registrations, total, nil
+}
+
+// EachEventRegistration calls fn for every registration of an event, oldest
+// first, without loading the whole roster into memory.
+func EachEventRegistration(eventIdStr string, fn func(*Registration) error) error {
+	eventIdObj, err := primitive.ObjectIDFromHex(eventIdStr)
+	if err != nil {
+		return errors.New("Invalid event ID format")
+	}
+
+	ctx := context.Background()
+
+	collection := db.GetDatabase().Collection("registrations")
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := collection.Find(ctx, notDeleted(bson.M{"eventId": eventIdObj}), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var registration Registration
+		if err := cursor.Decode(&registration); err != nil {
+			return err
+		}
+
+		user, err := GetUserById(registration.UserID.Hex())
+		if err != nil {
+			return err
+		}
+		registration.User = user
+
+		if err := fn(&registration); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
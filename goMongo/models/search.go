@@ -0,0 +1,202 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"example.com/goMongo/db"
+	"example.com/goMongo/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// EventSearch holds the parameters of an event search. Empty fields don't
+// filter.
+type EventSearch struct {
+	Query       string
+	IsAvailable *bool
+	Location    string
+	Category    string
+	From        time.Time
+	To          time.Time
+	Page        int64
+	Limit       int64
+}
+
+// EventSearchHit is an event matched by a search together with its relevance
+// score and highlighted snippets of the fields that matched.
+type EventSearchHit struct {
+	Event      `bson:",inline"`
+	Score      float64           `bson:"score" json:"score"`
+	Highlights map[string]string `bson:"-" json:"highlights,omitempty"`
+}
+
+// FacetCount is the number of matching events for one facet value.
+type FacetCount struct {
+	Value string `bson:"_id" json:"value"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+// EventSearchResult is one page of search hits plus facet counts computed
+// over every matching event.
+type EventSearchResult struct {
+	Hits   []EventSearchHit        `json:"hits"`
+	Total  int64                   `json:"total"`
+	Facets map[string][]FacetCount `json:"facets"`
+}
+
+// Date facet buckets, relative to the time of the search
+const (
+	DateBucketPast     = "past"
+	DateBucketToday    = "today"
+	DateBucketThisWeek = "thisWeek"
+	DateBucketMonth    = "thisMonth"
+	DateBucketLater    = "later"
+)
+
+// SearchEvents runs a full-text search over event names, descriptions and
+// locations, ranked by relevance, and computes location, category and date
+// facets in the same aggregation.
+func SearchEvents(search EventSearch) (*EventSearchResult, error) {
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	// Get a handle to the collection.
+	collection := db.GetDatabase().Collection("events")
+
+	match := bson.M{}
+	if search.Query != "" {
+		match["$text"] = bson.M{"$search": search.Query}
+	}
+	if search.IsAvailable != nil {
+		match["isAvailable"] = *search.IsAvailable
+	}
+	if search.Location != "" {
+		match["location"] = search.Location
+	}
+	if search.Category != "" {
+		match["category"] = search.Category
+	}
+	if !search.From.IsZero() || !search.To.IsZero() {
+		dateRange := bson.M{}
+		if !search.From.IsZero() {
+			dateRange["$gte"] = search.From
+		}
+		if !search.To.IsZero() {
+			dateRange["$lt"] = search.To
+		}
+		match["dateTime"] = dateRange
+	}
+
+	// Without a query there is no relevance, so the soonest events come first
+	sort := bson.D{{Key: "dateTime", Value: 1}}
+	score := interface{}(0)
+	if search.Query != "" {
+		score = bson.M{"$meta": "textScore"}
+		sort = bson.D{{Key: "score", Value: -1}, {Key: "dateTime", Value: 1}}
+	}
+
+	now := time.Now().UTC()
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$match": publicEventsFilter()},
+		{"$match": notDeleted(bson.M{})},
+		{"$addFields": bson.M{"score": score}},
+		{"$facet": bson.M{
+			"hits": []bson.M{
+				{"$sort": sort},
+				{"$skip": (search.Page - 1) * search.Limit},
+				{"$limit": search.Limit},
+			},
+			"total": []bson.M{{"$count": "count"}},
+			"location": []bson.M{
+				{"$group": bson.M{"_id": "$location", "count": bson.M{"$sum": 1}}},
+				{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+				{"$limit": 20},
+			},
+			"category": []bson.M{
+				{"$match": bson.M{"category": bson.M{"$nin": []interface{}{nil, ""}}}},
+				{"$group": bson.M{"_id": "$category", "count": bson.M{"$sum": 1}}},
+				{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+				{"$limit": 20},
+			},
+			"date": []bson.M{
+				{"$group": bson.M{
+					"_id": bson.M{"$switch": bson.M{
+						"branches": []bson.M{
+							{"case": bson.M{"$lt": bson.A{"$dateTime", now}}, "then": DateBucketPast},
+							{"case": bson.M{"$lt": bson.A{"$dateTime", now.Add(24 * time.Hour)}}, "then": DateBucketToday},
+							{"case": bson.M{"$lt": bson.A{"$dateTime", now.Add(7 * 24 * time.Hour)}}, "then": DateBucketThisWeek},
+							{"case": bson.M{"$lt": bson.A{"$dateTime", now.Add(30 * 24 * time.Hour)}}, "then": DateBucketMonth},
+						},
+						"default": DateBucketLater,
+					}},
+					"count": bson.M{"$sum": 1},
+				}},
+			},
+		}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var facets []struct {
+		Hits     []EventSearchHit `bson:"hits"`
+		Total    []FacetCount     `bson:"total"`
+		Location []FacetCount     `bson:"location"`
+		Category []FacetCount     `bson:"category"`
+		Date     []FacetCount     `bson:"date"`
+	}
+	if err := cursor.All(ctx, &facets); err != nil {
+		return nil, err
+	}
+
+	result := &EventSearchResult{
+		Hits:   []EventSearchHit{},
+		Facets: map[string][]FacetCount{},
+	}
+	if len(facets) == 0 {
+		return result, nil
+	}
+
+	facet := facets[0]
+	if len(facet.Total) > 0 {
+		result.Total = facet.Total[0].Count
+	}
+	result.Facets["location"] = nonNilFacet(facet.Location)
+	result.Facets["category"] = nonNilFacet(facet.Category)
+	result.Facets["date"] = nonNilFacet(facet.Date)
+
+	terms := utils.SearchTerms(search.Query)
+	for _, hit := range facet.Hits {
+		// Fetch user data for the event
+		user, err := GetUserById(hit.UserID.Hex())
+		if err != nil {
+			return nil, err // Error fetching user data
+		}
+		hit.User = user
+		hit.setLocalTime()
+
+		if len(terms) > 0 {
+			hit.Highlights = map[string]string{}
+			for field, text := range map[string]string{"name": hit.Name, "description": hit.Description, "location": hit.Location} {
+				if snippet := utils.Highlight(text, terms, 160); snippet != "" {
+					hit.Highlights[field] = snippet
+				}
+			}
+		}
+
+		result.Hits = append(result.Hits, hit)
+	}
+
+	return result, nil
+}
+
+func nonNilFacet(counts []FacetCount) []FacetCount {
+	if counts == nil {
+		return []FacetCount{}
+	}
+	return counts
+}
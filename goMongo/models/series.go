@@ -0,0 +1,545 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"example.com/goMongo/db"
+	"example.com/goMongo/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EventSeries is a recurring event. DateTime and EndDateTime describe the
+// first occurrence, and RRule says how it repeats.
+type EventSeries struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `binding:"required,notblank,max=200" bson:"name" json:"name"`
+	Description string             `binding:"required,max=5000" bson:"description" json:"description"`
+	Location    string             `binding:"required,notblank,max=200" bson:"location" json:"location"`
+	DateTime    time.Time          `binding:"required" bson:"dateTime" json:"dateTime"`
+	EndDateTime time.Time          `binding:"required" bson:"endDateTime" json:"endDateTime"`
+	TimeZone    string             `bson:"timeZone" json:"timeZone"`
+	RRule       string             `binding:"required" bson:"rrule" json:"rrule"` // RFC 5545 RRULE value, e.g. FREQ=WEEKLY;BYDAY=TU
+	Exceptions  []SeriesException  `bson:"exceptions" json:"exceptions"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"` // Reference to the User's ObjectID
+}
+
+// SeriesException cancels or reschedules a single occurrence of a series.
+type SeriesException struct {
+	OccurrenceStart time.Time  `binding:"required" bson:"occurrenceStart" json:"occurrenceStart"` // Start the rule produced for the occurrence
+	Cancelled       bool       `bson:"cancelled" json:"cancelled"`
+	DateTime        *time.Time `bson:"dateTime,omitempty" json:"dateTime,omitempty"`
+	EndDateTime     *time.Time `bson:"endDateTime,omitempty" json:"endDateTime,omitempty"`
+}
+
+// Occurrence is one date of a series after exceptions have been applied.
+type Occurrence struct {
+	OccurrenceStart time.Time           `json:"occurrenceStart"`
+	DateTime        time.Time           `json:"dateTime"`
+	EndDateTime     time.Time           `json:"endDateTime"`
+	Cancelled       bool                `json:"cancelled"`
+	Rescheduled     bool                `json:"rescheduled"`
+	EventID         *primitive.ObjectID `json:"eventId,omitempty"` // Set once the occurrence is materialized
+}
+
+// How far ahead occurrences are materialized as events, see
+// StartSeriesMaterializer
+var materializeWindow = 90 * 24 * time.Hour
+
+// Validate checks the schedule and the recurrence rule of the series.
+func (s *EventSeries) Validate() error {
+	schedule := Event{DateTime: s.DateTime, EndDateTime: s.EndDateTime, TimeZone: s.TimeZone}
+	if err := schedule.ValidateSchedule(); err != nil {
+		return err
+	}
+	s.DateTime, s.EndDateTime, s.TimeZone = schedule.DateTime, schedule.EndDateTime, schedule.TimeZone
+
+	rule, err := utils.ParseRRule(s.RRule)
+	if err != nil {
+		return fmt.Errorf("Invalid recurrence rule: %v", err)
+	}
+	s.RRule = rule.String()
+
+	return nil
+}
+
+// Occurrences expands the series over [from, to), applying its exceptions.
+// The window is matched against the dates the rule produced, so a
+// rescheduled occurrence stays where it was originally planned.
+func (s *EventSeries) Occurrences(from, to time.Time) ([]Occurrence, error) {
+	rule, err := utils.ParseRRule(s.RRule)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	duration := s.EndDateTime.Sub(s.DateTime)
+	exceptions := make(map[time.Time]SeriesException, len(s.Exceptions))
+	for _, exception := range s.Exceptions {
+		exceptions[exception.OccurrenceStart.UTC()] = exception
+	}
+
+	occurrences := []Occurrence{}
+	for _, start := range rule.Between(s.DateTime, loc, from, to) {
+		occurrence := Occurrence{
+			OccurrenceStart: start,
+			DateTime:        start,
+			EndDateTime:     start.Add(duration),
+		}
+
+		if exception, ok := exceptions[start]; ok {
+			occurrence.Cancelled = exception.Cancelled
+			if exception.DateTime != nil {
+				occurrence.DateTime = exception.DateTime.UTC()
+				occurrence.Rescheduled = true
+			}
+			if exception.EndDateTime != nil {
+				occurrence.EndDateTime = exception.EndDateTime.UTC()
+				occurrence.Rescheduled = true
+			} else if exception.DateTime != nil {
+				occurrence.EndDateTime = occurrence.DateTime.Add(duration)
+			}
+		}
+
+		occurrences = append(occurrences, occurrence)
+	}
+
+	return occurrences, nil
+}
+
+// HasOccurrence reports whether the rule produces an occurrence at start.
+func (s *EventSeries) HasOccurrence(start time.Time) (bool, error) {
+	occurrences, err := s.Occurrences(start, start.Add(time.Second))
+	if err != nil {
+		return false, err
+	}
+	return len(occurrences) == 1 && occurrences[0].OccurrenceStart.Equal(start), nil
+}
+
+func InsertSeries(series *EventSeries) (*mongo.InsertOneResult, error) {
+	if series.Exceptions == nil {
+		series.Exceptions = []SeriesException{}
+	}
+
+	collection := db.GetDatabase().Collection("series")
+	result, err := collection.InsertOne(context.TODO(), series)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the ID field of the series to the inserted ID
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		series.ID = oid
+	} else {
+		return nil, fmt.Errorf("failed to convert inserted ID to ObjectID")
+	}
+
+	return result, nil
+}
+
+// GetSeriesById retrieves an event series from the MongoDB database by ID.
+func GetSeriesById(id string) (*EventSeries, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("Invalid series ID format")
+	}
+
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	// Get a handle to the collection.
+	collection := db.GetDatabase().Collection("series")
+
+	var series EventSeries
+	if err := collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&series); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // Series not found
+		}
+		return nil, err // Other error occurred
+	}
+
+	return &series, nil
+}
+
+// SeriesOccurrences expands the series over [from, to) without writing
+// anything, and links the occurrences that were materialized to their
+// events.
+func SeriesOccurrences(series *EventSeries, from, to time.Time) ([]Occurrence, error) {
+	occurrences, err := series.Occurrences(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := notDeleted(bson.M{
+		"seriesId":        series.ID,
+		"occurrenceStart": bson.M{"$gte": from, "$lt": to},
+	})
+	ctx := context.Background()
+	cursor, err := db.GetDatabase().Collection("events").Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1, "occurrenceStart": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	eventIds := make(map[time.Time]primitive.ObjectID, len(events))
+	for _, event := range events {
+		eventIds[event.OccurrenceStart.UTC()] = event.ID
+	}
+
+	for i := range occurrences {
+		if id, ok := eventIds[occurrences[i].OccurrenceStart]; ok {
+			occurrences[i].EventID = &id
+		}
+	}
+	return occurrences, nil
+}
+
+// MaterializeUpcoming makes sure every occurrence of the series within the
+// materialize window exists as an Event, so it can be registered for like
+// any other event.
+func MaterializeUpcoming(ctx context.Context, series *EventSeries) error {
+	now := time.Now().UTC()
+	return materializeOccurrences(ctx, series, now, now.Add(materializeWindow))
+}
+
+func materializeOccurrences(ctx context.Context, series *EventSeries, from, to time.Time) error {
+	occurrences, err := series.Occurrences(from, to)
+	if err != nil {
+		return err
+	}
+
+	collection := db.GetDatabase().Collection("events")
+
+	// Only missing occurrences are inserted. Occurrences that exist keep
+	// their own edits, syncOccurrences applies changes to the series to them.
+	// A deleted occurrence doesn't match the filter, and the unique index
+	// keeps it from being inserted again.
+	for _, occurrence := range occurrences {
+		filter := notDeleted(bson.M{"seriesId": series.ID, "occurrenceStart": occurrence.OccurrenceStart})
+		fields := bson.M{"isAvailable": true, "status": EventStatusPublished, "version": 0}
+		for key, value := range occurrenceFields(series, occurrence) {
+			fields[key] = value
+		}
+		update := bson.M{"$setOnInsert": fields}
+		result, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) {
+			continue // Materialized concurrently, or deleted
+		}
+		if err != nil {
+			return err
+		}
+		recordBulkAudit(ctx, "events", AuditCreate, filter, update, result.UpsertedCount)
+	}
+
+	return nil
+}
+
+// MaterializeAllSeries materializes the upcoming occurrences of every
+// series, as the materialize window moves along with time.
+func MaterializeAllSeries() error {
+	ctx := context.Background()
+
+	cursor, err := db.GetDatabase().Collection("series").Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var series EventSeries
+		if err := cursor.Decode(&series); err != nil {
+			return err
+		}
+		if err := MaterializeUpcoming(ctx, &series); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// StartSeriesMaterializer runs MaterializeAllSeries every interval in the
+// background, keeping occurrences materialized window ahead.
+func StartSeriesMaterializer(interval, window time.Duration) {
+	materializeWindow = window
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := MaterializeAllSeries(); err != nil && !errors.Is(err, mongo.ErrClientDisconnected) {
+				log.Println("Failed to materialize series occurrences:", err)
+			}
+		}
+	}()
+}
+
+// AddSeriesException records a cancellation or new time for one occurrence,
+// replacing any earlier exception for the same occurrence.
+func AddSeriesException(ctx context.Context, series *EventSeries, exception SeriesException) (*EventSeries, error) {
+	exception.OccurrenceStart = exception.OccurrenceStart.UTC()
+
+	ok, err := series.HasOccurrence(exception.OccurrenceStart)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("The series has no occurrence at that time")
+	}
+
+	if exception.DateTime != nil || exception.EndDateTime != nil {
+		start, end := exception.OccurrenceStart, exception.OccurrenceStart.Add(series.EndDateTime.Sub(series.DateTime))
+		if exception.DateTime != nil {
+			start = *exception.DateTime
+			end = start.Add(series.EndDateTime.Sub(series.DateTime))
+		}
+		if exception.EndDateTime != nil {
+			end = *exception.EndDateTime
+		}
+		if !end.After(start) {
+			return nil, errors.New("Event end must be after its start")
+		}
+	}
+
+	exceptions := []SeriesException{}
+	for _, existing := range series.Exceptions {
+		if !existing.OccurrenceStart.Equal(exception.OccurrenceStart) {
+			exceptions = append(exceptions, existing)
+		}
+	}
+	series.Exceptions = append(exceptions, exception)
+
+	if err := replaceSeries(series); err != nil {
+		return nil, err
+	}
+	if err := syncOccurrences(ctx, series); err != nil {
+		return nil, err
+	}
+	if err := MaterializeUpcoming(ctx, series); err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
+
+// UpdateSeries stores changes to a whole series and brings the occurrences
+// that were already materialized in line with it.
+func UpdateSeries(ctx context.Context, series *EventSeries) (*EventSeries, error) {
+	if err := series.Validate(); err != nil {
+		return nil, err
+	}
+	if err := replaceSeries(series); err != nil {
+		return nil, err
+	}
+	if err := syncOccurrences(ctx, series); err != nil {
+		return nil, err
+	}
+	if err := MaterializeUpcoming(ctx, series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// SplitSeries implements "edit this and following": the original series is
+// ended just before the occurrence at from, and updated becomes a new series
+// that starts there. Exceptions and materialized events from that point on
+// move over to the new series.
+func SplitSeries(ctx context.Context, original *EventSeries, updated *EventSeries, from time.Time) (*EventSeries, *EventSeries, error) {
+	from = from.UTC()
+
+	ok, err := original.HasOccurrence(from)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, errors.New("The series has no occurrence at that time")
+	}
+
+	rule, err := utils.ParseRRule(original.RRule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Carry the remaining number of occurrences over to the new series
+	if rule.Count > 0 && updated.RRule == original.RRule {
+		before, err := original.Occurrences(original.DateTime, from)
+		if err != nil {
+			return nil, nil, err
+		}
+		newRule := *rule
+		newRule.Count = rule.Count - len(before)
+		updated.RRule = newRule.String()
+	}
+
+	var kept, moved []SeriesException
+	for _, exception := range original.Exceptions {
+		if exception.OccurrenceStart.Before(from) {
+			kept = append(kept, exception)
+		} else {
+			moved = append(moved, exception)
+		}
+	}
+
+	updated.ID = primitive.NilObjectID
+	updated.UserID = original.UserID
+	updated.Exceptions = moved
+	if err := updated.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if _, err := InsertSeries(updated); err != nil {
+		return nil, nil, err
+	}
+
+	rule.Count = 0
+	rule.Until = from.Add(-time.Second)
+	original.RRule = rule.String()
+	original.Exceptions = kept
+	if original.Exceptions == nil {
+		original.Exceptions = []SeriesException{}
+	}
+	if err := replaceSeries(original); err != nil {
+		return nil, nil, err
+	}
+
+	// Hand the already materialized occurrences over to the new series
+	_, err = updateManyAudited(ctx, "events", AuditUpdate,
+		bson.M{"seriesId": original.ID, "occurrenceStart": bson.M{"$gte": from}},
+		bson.M{"$set": bson.M{"seriesId": updated.ID}},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, series := range []*EventSeries{original, updated} {
+		if err := syncOccurrences(ctx, series); err != nil {
+			return nil, nil, err
+		}
+		if err := MaterializeUpcoming(ctx, series); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return original, updated, nil
+}
+
+func replaceSeries(series *EventSeries) error {
+	ctx := context.Background()
+	collection := db.GetDatabase().Collection("series")
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": series.ID}, series)
+	return err
+}
+
+// syncOccurrences updates the materialized events of a series that haven't
+// started yet. Events are matched to occurrences by their date in the
+// series' time zone, so changing the time of day moves them rather than
+// replacing them. Events on a date the series no longer produces are
+// cancelled rather than deleted, since people may have registered. Either
+// way registrants are told.
+func syncOccurrences(ctx context.Context, series *EventSeries) error {
+	filter := bson.M{"seriesId": series.ID, "dateTime": bson.M{"$gte": time.Now().UTC()}}
+	events, err := findEvents(filter, options.Find().SetSort(bson.D{{Key: "occurrenceStart", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	loc, err := time.LoadLocation(series.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	// Moving the time of day can move an occurrence by up to a day in UTC
+	from := events[0].OccurrenceStart.Add(-24 * time.Hour)
+	to := events[len(events)-1].OccurrenceStart.Add(24*time.Hour + time.Second)
+	occurrences, err := series.Occurrences(from, to)
+	if err != nil {
+		return err
+	}
+	byDate := make(map[string]Occurrence, len(occurrences))
+	for _, occurrence := range occurrences {
+		byDate[occurrenceDate(occurrence.OccurrenceStart, loc)] = occurrence
+	}
+
+	matched := make(map[string]bool, len(events))
+	for i := range events {
+		event := &events[i]
+		wasCancelled := event.Status == EventStatusCancelled
+
+		// A new time zone can put two events on one date, the later one
+		// is cancelled then
+		date := occurrenceDate(*event.OccurrenceStart, loc)
+		occurrence, ok := byDate[date]
+		ok = ok && !matched[date]
+		matched[date] = true
+		var update bson.M
+		if ok {
+			update = occurrenceFields(series, occurrence)
+			update["occurrenceStart"] = occurrence.OccurrenceStart
+			// The series cancelled it before, and produces it again
+			if wasCancelled && event.CancelledBySeries && !occurrence.Cancelled {
+				update["isAvailable"] = true
+				update["status"] = EventStatusPublished
+				update["cancelledBySeries"] = false
+			}
+		} else {
+			update = bson.M{"isAvailable": false, "status": EventStatusCancelled, "cancelledBySeries": true}
+		}
+		var updated Event
+		if err := updateOneAudited(ctx, "events", AuditUpdate, bson.M{"_id": event.ID}, bson.M{"$set": update}, &updated); err != nil {
+			return err
+		}
+
+		switch {
+		case wasCancelled:
+		case !ok || occurrence.Cancelled:
+			registrations, err := cancelEventRegistrations(ctx, event.ID)
+			if err != nil {
+				return err
+			}
+			notifyEventCancelled(event, registrations, "The occurrence was removed from the series.")
+		case !updated.DateTime.Equal(event.DateTime) || !updated.EndDateTime.Equal(event.EndDateTime):
+			registrations, err := activeRegistrations(ctx, event.ID)
+			if err != nil {
+				return err
+			}
+			notifyEventRescheduled(event, &updated, registrations)
+		}
+	}
+
+	return nil
+}
+
+// occurrenceDate is the date of an occurrence in the series' time zone.
+func occurrenceDate(start time.Time, loc *time.Location) string {
+	return start.In(loc).Format("2006-01-02")
+}
+
+// occurrenceFields are the event fields a series controls for an occurrence.
+func occurrenceFields(series *EventSeries, occurrence Occurrence) bson.M {
+	fields := bson.M{
+		"name":        series.Name,
+		"description": series.Description,
+		"location":    series.Location,
+		"dateTime":    occurrence.DateTime,
+		"endDateTime": occurrence.EndDateTime,
+		"timeZone":    series.TimeZone,
+		"userId":      series.UserID,
+	}
+	if occurrence.Cancelled {
+		fields["isAvailable"] = false
+		fields["status"] = EventStatusCancelled
+		fields["cancelledBySeries"] = true
+	}
+	return fields
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeriesOccurrencesWithExceptions(t *testing.T) {
+	start := time.Date(2030, 1, 1, 18, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	moved := start.Add(2*day + 2*time.Hour)
+	series := EventSeries{
+		DateTime:    start,
+		EndDateTime: start.Add(time.Hour),
+		TimeZone:    "UTC",
+		RRule:       "FREQ=DAILY;COUNT=4",
+		Exceptions: []SeriesException{
+			{OccurrenceStart: start.Add(day), Cancelled: true},
+			{OccurrenceStart: start.Add(2 * day), DateTime: &moved},
+		},
+	}
+
+	occurrences, err := series.Occurrences(start, start.Add(10*day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Occurrence{
+		{OccurrenceStart: start, DateTime: start, EndDateTime: start.Add(time.Hour)},
+		{OccurrenceStart: start.Add(day), DateTime: start.Add(day), EndDateTime: start.Add(day + time.Hour), Cancelled: true},
+		{OccurrenceStart: start.Add(2 * day), DateTime: moved, EndDateTime: moved.Add(time.Hour), Rescheduled: true},
+		{OccurrenceStart: start.Add(3 * day), DateTime: start.Add(3 * day), EndDateTime: start.Add(3*day + time.Hour)},
+	}
+	if len(occurrences) != len(want) {
+		t.Fatalf("got %d occurrences, want %d", len(occurrences), len(want))
+	}
+	for i, got := range occurrences {
+		w := want[i]
+		if !got.OccurrenceStart.Equal(w.OccurrenceStart) || !got.DateTime.Equal(w.DateTime) || !got.EndDateTime.Equal(w.EndDateTime) ||
+			got.Cancelled != w.Cancelled || got.Rescheduled != w.Rescheduled {
+			t.Errorf("occurrence %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	for _, test := range []struct {
+		start time.Time
+		want  bool
+	}{
+		{start.Add(day), true},
+		{start.Add(day + time.Hour), false},
+		{start.Add(4 * day), false},
+	} {
+		if got, err := series.HasOccurrence(test.start); err != nil || got != test.want {
+			t.Errorf("HasOccurrence(%s) = %v, %v, want %v", test.start, got, err, test.want)
+		}
+	}
+}
+
+func TestOccurrenceDate(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		start time.Time
+		loc   *time.Location
+		want  string
+	}{
+		{time.Date(2030, 3, 5, 18, 0, 0, 0, time.UTC), time.UTC, "2030-03-05"},
+		// 01:00 UTC is still the evening before in New York
+		{time.Date(2030, 3, 5, 1, 0, 0, 0, time.UTC), newYork, "2030-03-04"},
+		// Moving an evening occurrence past midnight UTC keeps its local date
+		{time.Date(2030, 3, 5, 3, 30, 0, 0, time.UTC), newYork, "2030-03-04"},
+	}
+	for _, test := range tests {
+		if got := occurrenceDate(test.start, test.loc); got != test.want {
+			t.Errorf("occurrenceDate(%s, %s) = %s, want %s", test.start, test.loc, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/goMongo/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrSessionRevoked  = errors.New("Session was revoked, log in again")
+	ErrSessionNotFound = errors.New("Session not found")
+)
+
+// Session is a login of a user on a device. Every access token names its
+// session, and stops working when the session is revoked. Sessions expire
+// together with their token through a TTL index.
+type Session struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	Device     string             `bson:"device" json:"device"`
+	UserAgent  string             `bson:"userAgent" json:"userAgent"`
+	IP         string             `bson:"ip" json:"ip"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	LastSeenAt time.Time          `bson:"lastSeenAt" json:"lastSeenAt"`
+	ExpiresAt  time.Time          `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	Current    bool               `bson:"-" json:"current"` // Whether the listing request came from this session
+}
+
+// CreateSession records a new login.
+func CreateSession(ctx context.Context, session *Session) error {
+	now := time.Now().UTC()
+	session.ID = primitive.NewObjectID()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+
+	collection := db.GetDatabase().Collection("sessions")
+	_, err := collection.InsertOne(ctx, session)
+	return err
+}
+
+// CheckSession returns ErrSessionRevoked unless the session of a token is
+// still active, and records that it was seen. Tokens issued before sessions
+// existed have none and pass until they expire, as long as their user
+// hasn't been deleted.
+func CheckSession(id, userId string) error {
+	if id == "" {
+		user, err := GetUserById(userId)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrSessionRevoked
+		}
+		return nil
+	}
+
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+	userObjectID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+
+	collection := db.GetDatabase().Collection("sessions")
+	var session Session
+	if err := collection.FindOne(ctx, bson.M{"_id": objectID, "userId": userObjectID}).Decode(&session); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+	if session.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+
+	// Recording every request would mean a write per request, a minute is
+	// precise enough
+	now := time.Now().UTC()
+	if now.Sub(session.LastSeenAt) > time.Minute {
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{"lastSeenAt": now}})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetSessions retrieves the active sessions of a user, most recently seen
+// first.
+func GetSessions(userId primitive.ObjectID) ([]Session, error) {
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	// Get a handle to the collection.
+	collection := db.GetDatabase().Collection("sessions")
+
+	filter := bson.M{"userId": userId, "revokedAt": nil, "expiresAt": bson.M{"$gt": time.Now().UTC()}}
+	opts := options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes one session of a user, which logs that device out.
+func RevokeSession(ctx context.Context, userId primitive.ObjectID, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+
+	filter := bson.M{"_id": objectID, "userId": userId, "revokedAt": nil}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}}
+	if err := updateOneAudited(ctx, "sessions", AuditUpdate, filter, update, nil); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of a user except the one given,
+// and returns how many were revoked.
+func RevokeOtherSessions(ctx context.Context, userId primitive.ObjectID, currentId string) (int64, error) {
+	filter := bson.M{"userId": userId, "revokedAt": nil}
+	if objectID, err := primitive.ObjectIDFromHex(currentId); err == nil {
+		filter["_id"] = bson.M{"$ne": objectID}
+	}
+
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}}
+	result, err := updateManyAudited(ctx, "sessions", AuditUpdate, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
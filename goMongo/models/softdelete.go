@@ -0,0 +1,199 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"example.com/goMongo/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collections that support soft deletion, by the name used in admin routes
+var softDeleteCollections = map[string]string{
+	"users":         "users",
+	"events":        "events",
+	"registrations": "registrations",
+}
+
+// ErrUnknownKind is returned for a record kind that can't be soft deleted.
+var ErrUnknownKind = errors.New("Unknown record kind, expected users, events or registrations")
+
+// notDeleted adds the condition that excludes soft deleted documents to a
+// filter. Every read in models goes through it unless it deliberately looks
+// at deleted records.
+func notDeleted(filter bson.M) bson.M {
+	filter["deletedAt"] = nil
+	return filter
+}
+
+// ListDeleted retrieves the soft deleted records of a kind, most recently
+// deleted first.
+func ListDeleted(kind string) (interface{}, error) {
+	collectionName, ok := softDeleteCollections[kind]
+	if !ok {
+		return nil, ErrUnknownKind
+	}
+
+	ctx := context.Background()
+
+	opts := options.Find().SetSort(bson.D{{Key: "deletedAt", Value: -1}}).SetLimit(500)
+	cursor, err := db.GetDatabase().Collection(collectionName).Find(ctx, bson.M{"deletedAt": bson.M{"$ne": nil}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "users":
+		users := []User{}
+		err = cursor.All(ctx, &users)
+		return users, err
+	case "events":
+		events := []Event{}
+		err = cursor.All(ctx, &events)
+		return events, err
+	default:
+		registrations := []Registration{}
+		err = cursor.All(ctx, &registrations)
+		return registrations, err
+	}
+}
+
+// Restore brings back a soft deleted record. Restoring an event also
+// restores the registrations deleted together with it, and a registration
+// can only be restored while its event exists.
+func Restore(ctx context.Context, kind string, id string) (bool, error) {
+	collectionName, ok := softDeleteCollections[kind]
+	if !ok {
+		return false, ErrUnknownKind
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, errors.New("Invalid ID format")
+	}
+
+	collection := db.GetDatabase().Collection(collectionName)
+	filter := bson.M{"_id": objectID, "deletedAt": bson.M{"$ne": nil}}
+
+	var deleted struct {
+		DeletedAt time.Time          `bson:"deletedAt"`
+		EventID   primitive.ObjectID `bson:"eventId"`
+	}
+	if err := collection.FindOne(ctx, filter).Decode(&deleted); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil // Nothing to restore
+		}
+		return false, err
+	}
+
+	if kind == "registrations" {
+		event, err := GetEventById(deleted.EventID.Hex())
+		if err != nil {
+			return false, err
+		}
+		if event == nil {
+			return false, errors.New("Restore the event of this registration first")
+		}
+	}
+
+	restore := bson.M{"$unset": bson.M{"deletedAt": ""}}
+	err = db.WithTransaction(ctx, func(ctx mongo.SessionContext) error {
+		if err := updateOneAudited(ctx, collectionName, AuditRestore, filter, restore, nil); err != nil {
+			return err
+		}
+		if kind == "events" {
+			_, err := updateManyAudited(ctx, "registrations", AuditRestore,
+				bson.M{"eventId": objectID, "deletedAt": deleted.DeletedAt},
+				restore,
+			)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PurgeDeleted permanently removes records that were soft deleted longer
+// than retention ago. Purged users go through the deletion policy in
+// cleanup.go first.
+func PurgeDeleted(retention time.Duration) error {
+	ctx := context.Background()
+	database := db.GetDatabase()
+	expired := bson.M{"deletedAt": bson.M{"$lt": time.Now().UTC().Add(-retention)}}
+
+	userIds, err := database.Collection("users").Distinct(ctx, "_id", expired)
+	if err != nil {
+		return err
+	}
+	for _, value := range userIds {
+		userId, ok := value.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+
+		var cancelled []cancelledEvent
+		err := db.WithTransaction(ctx, func(ctx mongo.SessionContext) error {
+			var err error
+			if cancelled, err = removeUserReferences(ctx, userId); err != nil {
+				return err
+			}
+			_, err = deleteManyAudited(ctx, "users", bson.M{"_id": userId})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, c := range cancelled {
+			notifyEventCancelled(&c.event, c.registrations, "The organizer's account was deleted.")
+		}
+	}
+
+	eventIds, err := database.Collection("events").Distinct(ctx, "_id", expired)
+	if err != nil {
+		return err
+	}
+	if len(eventIds) > 0 {
+		err = db.WithTransaction(ctx, func(ctx mongo.SessionContext) error {
+			if _, err := deleteManyAudited(ctx, "registrations", bson.M{"eventId": bson.M{"$in": eventIds}}); err != nil {
+				return err
+			}
+			_, err := deleteManyAudited(ctx, "events", bson.M{"_id": bson.M{"$in": eventIds}})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := deleteManyAudited(ctx, "registrations", expired)
+	if err != nil {
+		return err
+	}
+
+	if len(userIds) > 0 || len(eventIds) > 0 || result.DeletedCount > 0 {
+		log.Printf("Purged %d users, %d events and %d registrations", len(userIds), len(eventIds), result.DeletedCount)
+	}
+	return nil
+}
+
+// StartPurgeJob runs PurgeDeleted every interval in the background.
+func StartPurgeJob(interval, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := PurgeDeleted(retention); err != nil && !errors.Is(err, mongo.ErrClientDisconnected) {
+				log.Println("Failed to purge deleted records:", err)
+			}
+		}
+	}()
+}
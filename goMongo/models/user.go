@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"example.com/goMongo/db"
 	"example.com/goMongo/utils"
@@ -13,21 +15,58 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrInvalidCredentials is returned for an unknown email and for a wrong
+// password alike, so logins can't be used to find out who has an account.
+var ErrInvalidCredentials = errors.New("Invalid email or password")
+
+// User roles
+const (
+	RoleUser  = ""
+	RoleAdmin = "admin"
+)
+
 // User represents a user in the system
 type User struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name     string             `bson:"name" json:"name"`
-	Email    string             `binding:required bson:"email" json:"email"`
-	Password string             `binding:required bson:"password" json:"password"`
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name            string             `binding:"max=100" bson:"name" json:"name"`
+	Email           string             `binding:"required,email,max=254" bson:"email" json:"email"`
+	EmailVerified   bool               `bson:"emailVerified,omitempty" json:"emailVerified"` // The user proved they receive mail at Email
+	Password        string             `bson:"password" json:"-"`                            // Hashed, never leaves the server
+	Role            string             `bson:"role,omitempty" json:"role,omitempty"`         // Only set directly in the database
+	MFA             *UserMFA           `bson:"mfa,omitempty" json:"mfa,omitempty"`
+	Identities      []ExternalIdentity `bson:"identities,omitempty" json:"identities,omitempty"` // Linked OIDC accounts
+	CalendarFeedKey string             `bson:"calendarFeedKey,omitempty" json:"-"`               // Part of the calendar feed token, see calendar.go
+	DeletedAt       *time.Time         `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	Version         int64              `bson:"version" json:"version"` // Incremented on every update
 }
 
 // InsertUser inserts a new user into the database
-func InsertUser(user *User) (*mongo.InsertOneResult, error) {
+func InsertUser(ctx context.Context, user *User) (*mongo.InsertOneResult, error) {
+
+	// New users never start out as administrators
+	user.Role = RoleUser
+	user.Version = 0
+
+	// Two-factor authentication is set up through its own endpoints
+	user.MFA = nil
+
+	// External identities are only linked by logging in through them
+	user.Identities = nil
+
+	// The calendar feed key is made when the feed is first asked for
+	user.CalendarFeedKey = ""
+
+	// Signing up doesn't prove the address belongs to the user
+	user.EmailVerified = false
 
 	// Check if the email already exists
 	if emailExists(user.Email) {
 		return nil, errors.New("Email already exists")
 	}
+	if err := utils.ValidatePassword(user.Password, user.Email); err != nil {
+		return nil, err
+	}
+
 	// Hash the user's password before inserting
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
@@ -35,7 +74,7 @@ func InsertUser(user *User) (*mongo.InsertOneResult, error) {
 	}
 	user.Password = hashedPassword
 	collection := db.GetDatabase().Collection("users")
-	result, err := collection.InsertOne(context.TODO(), user)
+	result, err := collection.InsertOne(ctx, user)
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +85,7 @@ func InsertUser(user *User) (*mongo.InsertOneResult, error) {
 	} else {
 		return nil, fmt.Errorf("failed to convert inserted ID to ObjectID")
 	}
+	recordAudit(ctx, "users", AuditCreate, user.ID, nil, user)
 
 	return result, nil
 }
@@ -69,12 +109,14 @@ func emailExists(email string) bool {
 }
 func (u *User) ValidateCredentials() error {
 	// Search for the user by email
-	filter := bson.M{"email": u.Email}
+	filter := notDeleted(bson.M{"email": u.Email})
 	collection := db.GetDatabase().Collection("users")
 	var userFromDB User
 	err := collection.FindOne(context.TODO(), filter).Decode(&userFromDB)
 	if err == mongo.ErrNoDocuments {
-		return errors.New("Invalid email")
+		// Check a password anyway, so both failures take as long
+		utils.CheckPassword(u.Password, utils.DummyPasswordHash())
+		return ErrInvalidCredentials
 	} else if err != nil {
 		return err
 	}
@@ -82,11 +124,25 @@ func (u *User) ValidateCredentials() error {
 	// Compare the provided password with the retrieved password
 	passwordIsValid := utils.CheckPassword(u.Password, userFromDB.Password)
 	if !passwordIsValid {
-		return errors.New("Invalid password")
+		return ErrInvalidCredentials
+	}
+
+	// Hashes made with an older algorithm or parameters are replaced while
+	// the password is at hand. Only if the password didn't change meanwhile.
+	if utils.PasswordNeedsRehash(userFromDB.Password) {
+		if hashedPassword, err := utils.HashPassword(u.Password); err != nil {
+			fmt.Println("Error rehashing password:", err)
+		} else if err := updateOneAudited(context.TODO(), "users", AuditUpdate,
+			notDeleted(bson.M{"_id": userFromDB.ID, "password": userFromDB.Password}),
+			bson.M{"$set": bson.M{"password": hashedPassword}}, nil,
+		); err != nil && err != mongo.ErrNoDocuments {
+			fmt.Println("Error rehashing password:", err)
+		}
 	}
 
 	// Set the user ID from the retrieved user
 	u.ID = userFromDB.ID
+	u.MFA = userFromDB.MFA
 
 	return nil
 }
@@ -100,7 +156,7 @@ func GetUserById(id string) (*User, error) {
 	}
 
 	// Specify the filter to find the user by ID.
-	filter := bson.M{"_id": objectID}
+	filter := notDeleted(bson.M{"_id": objectID})
 
 	// Specify options to configure the query.
 	opts := options.FindOne()
@@ -132,7 +188,7 @@ func GetUsers() ([]User, error) {
 	collection := db.GetDatabase().Collection("users")
 
 	// Perform the query to find all users.
-	cursor, err := collection.Find(ctx, bson.M{})
+	cursor, err := collection.Find(ctx, notDeleted(bson.M{}))
 	if err != nil {
 		return nil, err // Other error occurred
 	}
@@ -156,34 +212,70 @@ func GetUsers() ([]User, error) {
 }
 
 // UpdateUserById updates a user's details in the MongoDB database by ID.
-func UpdateUserById(id string, updateData bson.M) (*User, error) {
+func UpdateUserById(ctx context.Context, id string, updateData bson.M) (*User, error) {
+	return updateUser(ctx, id, nil, updateData)
+}
+
+// UpdateUserByIdAtVersion updates a user only if they are still at version,
+// and returns ErrVersionConflict when someone else changed them first.
+func UpdateUserByIdAtVersion(ctx context.Context, id string, version int64, updateData bson.M) (*User, error) {
+	return updateUser(ctx, id, &version, updateData)
+}
+
+func updateUser(ctx context.Context, id string, version *int64, updateData bson.M) (*User, error) {
 	// Convert the id string to a MongoDB ObjectID
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, errors.New("Invalid user ID format")
 	}
 
+	// Roles are granted by administrators, not through profile updates
+	delete(updateData, "role")
+
+	// The version is only ever incremented
+	delete(updateData, "version")
+
+	// Passwords, two-factor setup, linked identities and the calendar feed
+	// have their own endpoints, and none may be changed field by field either
+	for field := range updateData {
+		for _, protected := range []string{"password", "mfa", "identities", "calendarFeedKey", "emailVerified"} {
+			if field == protected || strings.HasPrefix(field, protected+".") {
+				delete(updateData, field)
+			}
+		}
+	}
+
 	// Check if the email already exists if the email is being updated
 	if newEmail, ok := updateData["email"].(string); ok && emailExists(newEmail) {
 		return nil, errors.New("Email already exists")
 	}
+	// A new address hasn't been verified
+	if _, ok := updateData["email"]; ok {
+		updateData["emailVerified"] = false
+	}
 
 	// Specify the filter to find the user by ID.
-	filter := bson.M{"_id": objectID}
-
-	// Context to use for the operation.
-	ctx := context.Background()
-
-	// Get a handle to the collection.
-	collection := db.GetDatabase().Collection("users")
+	filter := notDeleted(bson.M{"_id": objectID})
+	if version != nil {
+		filter = atVersion(filter, *version)
+	}
 
 	// Specify the update
 	update := bson.M{"$set": updateData}
 
 	// Perform the update.
 	var updatedUser User
-	if err := collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedUser); err != nil {
+	if err := updateOneAudited(ctx, "users", AuditUpdate, filter, update, &updatedUser); err != nil {
 		if err == mongo.ErrNoDocuments {
+			if version != nil {
+				existing, err := GetUserById(id)
+				if err != nil {
+					return nil, err
+				}
+				if existing != nil {
+					return nil, ErrVersionConflict
+				}
+			}
 			return nil, nil // User not found
 		}
 		return nil, err // Other error occurred
@@ -192,34 +284,66 @@ func UpdateUserById(id string, updateData bson.M) (*User, error) {
 	return &updatedUser, nil
 }
 
-// GetUserById retrieves a user from the MongoDB database by ID.
-func DeleteUser(id string) (*User, error) {
+// DeleteUser soft deletes a user following the deletion policy in
+// cleanup.go. Their sessions are revoked, and their events are transferred
+// to transferToId when it is given, and cancelled otherwise. Callers only
+// pass transferToId for admins, the recipient doesn't get to agree.
+func DeleteUser(ctx context.Context, id string, transferToId string) (*User, error) {
 	// Convert the id string to a MongoDB ObjectID
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, errors.New("Invalid user ID format")
 	}
 
-	// Specify the filter to find the user by ID.
-	filter := bson.M{"_id": objectID}
-
-	// Specify options to configure the query.
-	opts := options.FindOneAndDelete()
+	var newOwner primitive.ObjectID
+	if transferToId != "" {
+		newOwner, err = primitive.ObjectIDFromHex(transferToId)
+		if err != nil || newOwner == objectID {
+			return nil, ErrTransferTarget
+		}
+		recipient, err := GetUserById(transferToId)
+		if err != nil {
+			return nil, err
+		}
+		if recipient == nil {
+			return nil, ErrTransferTarget
+		}
+	}
 
-	// Context to use for the operation.
-	ctx := context.Background()
+	var user *User
+	var cancelled []cancelledEvent
+	err = db.WithTransaction(ctx, func(ctx mongo.SessionContext) error {
+		// Perform the query.
+		var deleted User
+		update := bson.M{"$set": bson.M{"deletedAt": time.Now().UTC()}}
+		if err := updateOneAudited(ctx, "users", AuditDelete, notDeleted(bson.M{"_id": objectID}), update, &deleted); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil // User not found
+			}
+			return err // Other error occurred
+		}
+		user = &deleted
 
-	// Get a handle to the collection.
-	collection := db.GetDatabase().Collection("users")
+		// Tokens of the user stop working right away, not when they expire
+		revoke := bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}}
+		if _, err := updateManyAudited(ctx, "sessions", AuditUpdate, bson.M{"userId": objectID, "revokedAt": nil}, revoke); err != nil {
+			return err
+		}
 
-	// Perform the query.
-	var user User
-	if err := collection.FindOneAndDelete(ctx, filter, opts).Decode(&user); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil // User not found
+		if transferToId != "" {
+			return transferUserEvents(ctx, objectID, newOwner)
 		}
-		return nil, err // Other error occurred
+		var err error
+		cancelled, err = cancelUpcomingEvents(ctx, objectID)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return &user, nil
+	for _, c := range cancelled {
+		notifyEventCancelled(&c.event, c.registrations, "The organizer's account was deleted.")
+	}
+
+	return user, nil
 }
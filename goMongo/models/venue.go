@@ -0,0 +1,337 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/goMongo/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Venue is a place events are held at.
+type Venue struct {
+	ID                 primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name               string             `binding:"required,notblank,max=200" bson:"name" json:"name"`
+	Address            string             `binding:"required,notblank,max=500" bson:"address" json:"address"`
+	Coordinates        *GeoPoint          `bson:"coordinates,omitempty" json:"coordinates,omitempty"`
+	Capacity           int                `binding:"required" bson:"capacity" json:"capacity"`
+	AccessibilityNotes string             `bson:"accessibilityNotes" json:"accessibilityNotes"`
+	UserID             primitive.ObjectID `bson:"userId" json:"userId"` // Owner of the venue
+}
+
+// ErrVenueBooked is returned when an event overlaps another at the same venue.
+var ErrVenueBooked = errors.New("The venue is already booked for that time")
+
+// Validate checks the capacity and coordinates of the venue.
+func (v *Venue) Validate() error {
+	if v.Capacity < 1 {
+		return errors.New("Venue capacity must be at least 1")
+	}
+	if v.Coordinates != nil {
+		return v.Coordinates.Validate()
+	}
+	return nil
+}
+
+func InsertVenue(venue *Venue) (*mongo.InsertOneResult, error) {
+	collection := db.GetDatabase().Collection("venues")
+	result, err := collection.InsertOne(context.TODO(), venue)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the ID field of the venue to the inserted ID
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		venue.ID = oid
+	} else {
+		return nil, fmt.Errorf("failed to convert inserted ID to ObjectID")
+	}
+
+	return result, nil
+}
+
+// GetVenues retrieves all venues from the MongoDB database.
+func GetVenues() ([]Venue, error) {
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	// Get a handle to the collection.
+	collection := db.GetDatabase().Collection("venues")
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err // Other error occurred
+	}
+
+	venues := []Venue{}
+	if err := cursor.All(ctx, &venues); err != nil {
+		return nil, err
+	}
+
+	return venues, nil
+}
+
+// GetVenueById retrieves a venue from the MongoDB database by ID.
+func GetVenueById(id string) (*Venue, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("Invalid venue ID format")
+	}
+
+	// Context to use for the operation.
+	ctx := context.Background()
+
+	// Get a handle to the collection.
+	collection := db.GetDatabase().Collection("venues")
+
+	var venue Venue
+	if err := collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&venue); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // Venue not found
+		}
+		return nil, err // Other error occurred
+	}
+
+	return &venue, nil
+}
+
+// UpdateVenue replaces the stored venue. The capacity can't drop below the
+// capacity of an upcoming event at the venue.
+func UpdateVenue(ctx context.Context, venue *Venue) (*Venue, error) {
+	if err := venue.Validate(); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"venueId":     venue.ID,
+		"endDateTime": bson.M{"$gt": time.Now().UTC()},
+		"capacity":    bson.M{"$gt": venue.Capacity},
+	}
+	count, err := db.GetDatabase().Collection("events").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("Upcoming events at this venue need a larger capacity")
+	}
+
+	collection := db.GetDatabase().Collection("venues")
+	if _, err := collection.ReplaceOne(ctx, bson.M{"_id": venue.ID}, venue); err != nil {
+		return nil, err
+	}
+
+	// Keep the location copied onto upcoming events in line with the venue
+	update := bson.M{"location": venue.Name + ", " + venue.Address}
+	if venue.Coordinates != nil {
+		update["coordinates"] = venue.Coordinates
+	}
+	_, err = updateManyAudited(ctx, "events", AuditUpdate,
+		bson.M{"venueId": venue.ID, "endDateTime": bson.M{"$gt": time.Now().UTC()}},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return venue, nil
+}
+
+// DeleteVenue removes a venue that no upcoming event is held at.
+func DeleteVenue(id string) (*Venue, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("Invalid venue ID format")
+	}
+
+	ctx := context.Background()
+
+	filter := bson.M{"venueId": objectID, "endDateTime": bson.M{"$gt": time.Now().UTC()}}
+	count, err := db.GetDatabase().Collection("events").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("The venue still has upcoming events")
+	}
+
+	collection := db.GetDatabase().Collection("venues")
+
+	var venue Venue
+	if err := collection.FindOneAndDelete(ctx, bson.M{"_id": objectID}).Decode(&venue); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // Venue not found
+		}
+		return nil, err // Other error occurred
+	}
+
+	return &venue, nil
+}
+
+// CheckVenueBooking validates an event against its venue: the capacity must
+// fit, and no other event may be at the venue at an overlapping time. The
+// venue's name, address and coordinates are copied onto the event so search
+// and nearby queries keep working on events alone.
+//
+// The venue stays locked against other bookings until release is called, so
+// the caller stores the event before releasing and the overlap check can't
+// race another booking. release is never nil.
+func CheckVenueBooking(ctx context.Context, event *Event) (release func(), err error) {
+	release = func() {}
+	if event.VenueID == nil {
+		return release, nil
+	}
+
+	venue, err := GetVenueById(event.VenueID.Hex())
+	if err != nil {
+		return release, err
+	}
+	if venue == nil {
+		return release, errors.New("Venue not found")
+	}
+
+	if event.Capacity == 0 {
+		event.Capacity = venue.Capacity
+	}
+	if event.Capacity > venue.Capacity {
+		return release, fmt.Errorf("Event capacity can't exceed the venue capacity of %d", venue.Capacity)
+	}
+
+	unlock, err := lockVenue(ctx, venue.ID)
+	if err != nil {
+		return release, err
+	}
+
+	// Two events overlap when each starts before the other ends. Events
+	// stored without an end last defaultEventDuration, like new ones.
+	filter := notDeleted(bson.M{
+		"venueId":  venue.ID,
+		"_id":      bson.M{"$ne": event.ID},
+		"dateTime": bson.M{"$lt": event.EndDateTime},
+		"status":   bson.M{"$ne": EventStatusCancelled},
+		"$or": []bson.M{
+			{"endDateTime": bson.M{"$gt": event.DateTime}},
+			{
+				"endDateTime": bson.M{"$in": []interface{}{nil, time.Time{}}},
+				"dateTime":    bson.M{"$gt": event.DateTime.Add(-defaultEventDuration)},
+			},
+		},
+	})
+	count, err := db.GetDatabase().Collection("events").CountDocuments(ctx, filter)
+	if err != nil {
+		unlock()
+		return release, err
+	}
+	if count > 0 {
+		unlock()
+		return release, ErrVenueBooked
+	}
+
+	event.Location = venue.Name + ", " + venue.Address
+	event.Coordinates = venue.Coordinates
+	return unlock, nil
+}
+
+// ErrVenueBusy is returned when another booking holds a venue for too long.
+var ErrVenueBusy = errors.New("The venue is being booked by someone else, try again")
+
+// Bookings hold a venue for at most venueLockLease, so a crashed server
+// doesn't lock it for good, and wait at most venueLockWait for it.
+var (
+	venueLockLease = 30 * time.Second
+	venueLockWait  = 5 * time.Second
+)
+
+// lockVenue claims the lock document of a venue. The lock is an upsert on
+// the venue ID that only matches an expired lock, so while someone holds it
+// the upsert fails with a duplicate key and the claim is retried.
+func lockVenue(ctx context.Context, venueId primitive.ObjectID) (func(), error) {
+	collection := db.GetDatabase().Collection("venueLocks")
+	token := primitive.NewObjectID()
+	deadline := time.Now().Add(venueLockWait)
+
+	for {
+		now := time.Now().UTC()
+		filter := bson.M{"_id": venueId, "expiresAt": bson.M{"$lte": now}}
+		update := bson.M{"$set": bson.M{"token": token, "expiresAt": now.Add(venueLockLease)}}
+		_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrVenueBusy
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	return func() {
+		// Only drop the lock while it is still ours, it may have expired
+		if _, err := collection.DeleteOne(context.Background(), bson.M{"_id": venueId, "token": token}); err != nil {
+			fmt.Println("Failed to release venue lock:", err)
+		}
+	}, nil
+}
+
+// ApplyVenueUpdate merges venue and capacity changes from a raw update into
+// the event, checks the booking and rewrites the update to match. It has to
+// run after ApplyScheduleUpdate so the overlap check sees the new times. As
+// with CheckVenueBooking, call release once the update is stored.
+func ApplyVenueUpdate(ctx context.Context, event *Event, updateData bson.M) (release func(), err error) {
+	release = func() {}
+	_, hasVenue := updateData["venueId"]
+	_, hasCapacity := updateData["capacity"]
+	_, hasStart := updateData["dateTime"]
+	_, hasEnd := updateData["endDateTime"]
+	if !hasVenue && !hasCapacity && !(event.VenueID != nil && (hasStart || hasEnd)) {
+		return release, nil
+	}
+
+	if hasVenue {
+		switch value := updateData["venueId"].(type) {
+		case nil:
+			event.VenueID = nil
+		case string:
+			venueId, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				return release, errors.New("Invalid venue ID format")
+			}
+			event.VenueID = &venueId
+		default:
+			return release, errors.New("Invalid venue ID format")
+		}
+		updateData["venueId"] = event.VenueID
+	}
+	if hasCapacity {
+		capacity, ok := updateData["capacity"].(int)
+		if value, isFloat := updateData["capacity"].(float64); isFloat {
+			capacity, ok = int(value), value == float64(int(value))
+		}
+		if !ok || capacity < 0 {
+			return release, errors.New("Capacity must be a positive whole number")
+		}
+		event.Capacity = capacity
+		updateData["capacity"] = event.Capacity
+	}
+
+	release, err = CheckVenueBooking(ctx, event)
+	if err != nil {
+		return release, err
+	}
+	if event.VenueID != nil {
+		updateData["capacity"] = event.Capacity
+		updateData["location"] = event.Location
+		updateData["coordinates"] = event.Coordinates
+	}
+	return release, nil
+}
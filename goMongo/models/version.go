@@ -0,0 +1,44 @@
+package models
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrVersionConflict is returned when a document changed since the version
+// an update was based on was read.
+var ErrVersionConflict = errors.New("The record was changed in the meantime, fetch it again")
+
+// Collections whose documents carry a version counter. Every update through
+// updateOneAudited or updateManyAudited increments it, so a version read
+// once identifies exactly one state of the document.
+var versionedCollections = map[string]bool{
+	"users":  true,
+	"events": true,
+}
+
+// withVersionBump returns a copy of update that also increments the version
+// of a versioned collection.
+func withVersionBump(collectionName string, update bson.M) bson.M {
+	if !versionedCollections[collectionName] {
+		return update
+	}
+	bumped := bson.M{}
+	for operator, fields := range update {
+		bumped[operator] = fields
+	}
+	bumped["$inc"] = bson.M{"version": 1}
+	return bumped
+}
+
+// atVersion adds the condition that the document is still at version to a
+// filter. Documents written before versions existed count as version 0.
+func atVersion(filter bson.M, version int64) bson.M {
+	if version == 0 {
+		filter["version"] = bson.M{"$in": []interface{}{0, nil}}
+	} else {
+		filter["version"] = version
+	}
+	return filter
+}
@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"example.com/goMongo/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// listDeleted lists soft deleted users, events or registrations.
+func listDeleted(c *gin.Context) {
+	records, err := models.ListDeleted(c.Param("kind"))
+	if err == models.ErrUnknownKind {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch deleted records"})
+		fmt.Println(err)
+		return
+	}
+	if users, ok := records.([]models.User); ok {
+		deleted := make([]deletedUser, len(users))
+		for i := range users {
+			deleted[i] = newDeletedUser(&users[i])
+		}
+		records = deleted
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted records fetched", c.Param("kind"): records})
+}
+
+// deletedUser is what admins get to see of a deleted user, enough to decide
+// on restoring it without credentials, two-factor setup or linked accounts.
+type deletedUser struct {
+	ID        primitive.ObjectID `json:"id"`
+	Name      string             `json:"name"`
+	Email     string             `json:"email"`
+	Role      string             `json:"role,omitempty"`
+	DeletedAt *time.Time         `json:"deletedAt"`
+}
+
+func newDeletedUser(user *models.User) deletedUser {
+	return deletedUser{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Role:      user.Role,
+		DeletedAt: user.DeletedAt,
+	}
+}
+
+// restoreDeleted brings back a soft deleted record.
+func restoreDeleted(c *gin.Context) {
+	restored, err := models.Restore(c, c.Param("kind"), c.Param("id"))
+	if err == models.ErrUnknownKind {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !restored {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Deleted record not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "record restored"})
+}
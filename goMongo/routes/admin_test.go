@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/goMongo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDeletedUserLeavesOutSecrets(t *testing.T) {
+	deletedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	user := models.User{
+		ID:              primitive.NewObjectID(),
+		Name:            "Ada",
+		Email:           "ada@example.com",
+		Password:        "$2a$10$hash",
+		MFA:             &models.UserMFA{Secret: "encrypted", Enabled: true},
+		Identities:      []models.ExternalIdentity{{Provider: "google", Subject: "123"}},
+		CalendarFeedKey: "feedkey",
+		DeletedAt:       &deletedAt,
+	}
+
+	body, err := json.Marshal(newDeletedUser(&user))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"id", "name", "email", "deletedAt"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("%s is missing from %s", key, body)
+		}
+	}
+	for _, key := range []string{"password", "mfa", "identities", "calendarFeedKey", "version"} {
+		if _, ok := fields[key]; ok {
+			t.Errorf("%s leaked in %s", key, body)
+		}
+	}
+	if strings.Contains(string(body), "hash") {
+		t.Errorf("password hash leaked in %s", body)
+	}
+}
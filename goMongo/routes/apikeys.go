@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/goMongo/config"
+	"example.com/goMongo/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Lifetime of API keys created without an expiry
+var apiKeyDefaultTTL = config.Duration("API_KEY_DEFAULT_TTL", 90*24*time.Hour)
+
+type apiKeyRequest struct {
+	Name      string     `json:"name" binding:"required,notblank,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	NoExpiry  bool       `json:"noExpiry"` // Explicitly ask for a key that never expires
+}
+
+// createAPIKey creates an API key for the user. The key is only part of
+// this response.
+func createAPIKey(c *gin.Context) {
+	var request apiKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+
+	expiresAt := request.ExpiresAt
+	if request.NoExpiry {
+		expiresAt = nil
+	} else if expiresAt == nil {
+		defaultExpiry := time.Now().UTC().Add(apiKeyDefaultTTL)
+		expiresAt = &defaultExpiry
+	} else if !expiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "expiresAt must be in the future"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	apiKey, key, err := models.CreateAPIKey(c, user.ID, request.Name, request.Scopes, expiresAt)
+	if err == models.ErrUnknownScope {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to create API key"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API key created, store it somewhere safe as it isn't shown again",
+		"apiKey":  apiKey,
+		"key":     key,
+	})
+}
+
+// listAPIKeys lists the user's API keys, without the keys themselves.
+func listAPIKeys(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	apiKeys, err := models.GetAPIKeys(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch API keys"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API keys fetched", "apiKeys": apiKeys})
+}
+
+// revokeAPIKey revokes one of the user's API keys.
+func revokeAPIKey(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	apiKey, err := models.RevokeAPIKey(c, user.ID, c.Param("id"))
+	if err == models.ErrAPIKeyNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to revoke API key"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked", "apiKey": apiKey})
+}
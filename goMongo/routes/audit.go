@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/goMongo/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// listAudit lists audit log entries, newest first, optionally narrowed down
+// by collection, document, actor, action, request and time range.
+func listAudit(c *gin.Context) {
+	filter := models.AuditFilter{
+		Collection: c.Query("collection"),
+		DocumentID: c.Query("documentId"),
+		ActorID:    c.Query("actorId"),
+		Action:     c.Query("action"),
+		RequestID:  c.Query("requestId"),
+	}
+
+	if filter.DocumentID != "" && !primitive.IsValidObjectID(filter.DocumentID) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid document ID format"})
+		return
+	}
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if filter.From, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid from, expected RFC 3339"})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if filter.To, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid to, expected RFC 3339"})
+			return
+		}
+	}
+
+	filter.Page, err = strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if err != nil || filter.Page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid page"})
+		return
+	}
+	filter.Limit, err = strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if err != nil || filter.Limit < 1 || filter.Limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit, must be between 1 and 100"})
+		return
+	}
+
+	entries, total, err := models.ListAudit(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch audit log"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Audit log fetched",
+		"entries": entries,
+		"page":    filter.Page,
+		"limit":   filter.Limit,
+		"total":   total,
+	})
+}
@@ -0,0 +1,170 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"example.com/goMongo/models"
+	"example.com/goMongo/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// eventToICal maps an event onto the fields of a VEVENT.
+func eventToICal(event *models.Event, status string) utils.ICalEvent {
+	return utils.ICalEvent{
+		UID:         event.ID.Hex() + "@goMongo",
+		Summary:     event.Name,
+		Description: event.Description,
+		Location:    event.Location,
+		Start:       event.DateTime,
+		End:         event.EndDateTime,
+		Status:      status,
+	}
+}
+
+func writeICal(c *gin.Context, filename, body string) {
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(body))
+}
+
+// calendarSuffix takes the .ics suffix off the id parameter of GET
+// /events/:id, so the ObjectID check that follows sees the bare ID, and
+// marks the request as asking for iCalendar. Gin can't match a suffix on a
+// path parameter itself.
+func calendarSuffix(c *gin.Context) {
+	for i, param := range c.Params {
+		if id, ok := strings.CutSuffix(param.Value, ".ics"); ok && param.Key == "id" {
+			c.Params[i].Value = id
+			c.Set("ics", true)
+		}
+	}
+	c.Next()
+}
+
+// eventICS serves GET /events/:id.ics, getEventByID hands requests marked
+// by calendarSuffix over to it.
+func eventICS(c *gin.Context, eventId string) {
+	event, err := models.GetEventById(eventId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch event"})
+		fmt.Println(err)
+		return
+	}
+	if event == nil || !event.IsPublic() {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Event not found"})
+		return
+	}
+
+	status := "CONFIRMED"
+	if event.Status == models.EventStatusCancelled {
+		status = "CANCELLED"
+	}
+
+	body := utils.BuildICalendar(event.Name, []utils.ICalEvent{eventToICal(event, status)})
+	writeICal(c, event.ID.Hex()+".ics", body)
+}
+
+// calendarLink returns the subscription URL of the user's calendar feed.
+func calendarLink(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	token, err := models.CalendarToken(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to create calendar link"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, calendarLinkResponse("Calendar link fetched", token))
+}
+
+// rotateCalendarLink replaces the user's calendar feed URL, for when the old
+// one was shared by mistake.
+func rotateCalendarLink(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	token, err := models.RotateCalendarToken(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to rotate calendar link"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, calendarLinkResponse("Calendar link replaced, the old one no longer works", token))
+}
+
+// revokeCalendarLink turns the user's calendar feed off. Asking for the link
+// again turns it back on with a new URL.
+func revokeCalendarLink(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := models.RevokeCalendarToken(c, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to revoke calendar link"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar link revoked"})
+}
+
+func calendarLinkResponse(message, token string) gin.H {
+	return gin.H{
+		"message": message,
+		"token":   token,
+		"url":     "/users/me/calendar.ics?token=" + token,
+	}
+}
+
+// calendarFeed serves the calendar of the events a user registered for.
+// Calendar apps subscribe with a plain URL, so it takes a feed token in the
+// query. Access tokens aren't accepted there, since URLs end up in logs.
+func calendarFeed(c *gin.Context) {
+	user, err := models.AuthenticateCalendarToken(c.Query("token"))
+	if err == models.ErrInvalidCalendarToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch user"})
+		fmt.Println(err)
+		return
+	}
+
+	registrations, err := models.RegisteredEvents(user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch registrations"})
+		fmt.Println(err)
+		return
+	}
+
+	events := []utils.ICalEvent{}
+	for _, registration := range registrations {
+		event, err := models.GetEventById(registration.EventID.Hex())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch event"})
+			fmt.Println(err)
+			return
+		}
+		if event == nil {
+			continue
+		}
+
+		status := "CONFIRMED"
+		if registration.Status == models.RegistrationStatusCancelled || event.Status == models.EventStatusCancelled {
+			status = "CANCELLED"
+		}
+		events = append(events, eventToICal(event, status))
+	}
+
+	writeICal(c, "calendar.ics", utils.BuildICalendar("My events", events))
+}
@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/goMongo/middlewares"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCalendarSuffix(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	// The route of getEventByID, answering with what the handler would see
+	server.GET("/events/:id", calendarSuffix, middlewares.ObjectIDParams("id"), func(c *gin.Context) {
+		if c.GetBool("ics") {
+			c.String(http.StatusOK, "ics "+c.Param("id"))
+			return
+		}
+		c.String(http.StatusOK, "json "+c.Param("id"))
+	})
+
+	id := primitive.NewObjectID().Hex()
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/events/" + id + ".ics", http.StatusOK, "ics " + id},
+		{"/events/" + id, http.StatusOK, "json " + id},
+		{"/events/nothex.ics", http.StatusBadRequest, ""},
+		{"/events/" + id + ".ics.ics", http.StatusBadRequest, ""},
+		{"/events/" + id + ".json", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if recorder.Code != test.wantStatus {
+			t.Errorf("GET %s: status %d, want %d", test.path, recorder.Code, test.wantStatus)
+			continue
+		}
+		if test.wantBody != "" && recorder.Body.String() != test.wantBody {
+			t.Errorf("GET %s: %q, want %q", test.path, recorder.Body.String(), test.wantBody)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"example.com/goMongo/models"
+	"github.com/gin-gonic/gin"
+)
+
+func getCategories(c *gin.Context) {
+	categories, err := models.GetCategories()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch categories"})
+		fmt.Println(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Categories fetched", "categories": categories})
+}
+
+func createCategory(c *gin.Context) {
+	var category models.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	if _, err := models.InsertCategory(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "category created successfully", "category": category})
+}
+
+func updateCategory(c *gin.Context) {
+	var request struct {
+		Name        string `json:"name" binding:"required,notblank,max=100"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	category, err := models.UpdateCategory(c.Param("slug"), request.Name, request.Description)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to update category"})
+		fmt.Println(err)
+		return
+	}
+	if category == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Category not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "category updated", "category": category})
+}
+
+func deleteCategory(c *gin.Context) {
+	category, err := models.DeleteCategory(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if category == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Category not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "category Deleted"})
+}
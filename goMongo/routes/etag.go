@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionETag is the ETag of a document at the given version.
+func versionETag(version int64) string {
+	return fmt.Sprintf(`"v%d"`, version)
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag.
+// Weak validators compare equal to their strong form.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag of a document and answers 304 when the client
+// sent it in If-None-Match, meaning its copy is still current.
+func notModified(c *gin.Context, version int64) bool {
+	etag := versionETag(version)
+	c.Header("ETag", etag)
+	if header := c.GetHeader("If-None-Match"); header != "" && etagMatches(header, etag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// preconditionFailed answers 412 when the request sent If-Match and the
+// document is no longer at any of the listed versions.
+func preconditionFailed(c *gin.Context, version int64) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || etagMatches(header, versionETag(version)) {
+		return false
+	}
+	c.JSON(http.StatusPreconditionFailed, gin.H{"message": "The record was changed in the meantime, fetch it again"})
+	return true
+}
+
+// versionConflict answers an ErrVersionConflict from the models. It is a
+// failed precondition when the client sent If-Match, and a plain conflict
+// when the update raced with another one on its own.
+func versionConflict(c *gin.Context, err error) {
+	status := http.StatusConflict
+	if c.GetHeader("If-Match") != "" {
+		status = http.StatusPreconditionFailed
+	}
+	c.JSON(status, gin.H{"message": err.Error()})
+}
@@ -3,6 +3,9 @@ package routes
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"example.com/goMongo/models"
 	"github.com/gin-gonic/gin"
@@ -37,7 +40,45 @@ func createEvent(c *gin.Context) {
 
 	err = c.ShouldBind(&event)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		validationFailed(c, err)
+		return
+	}
+
+	if err := event.ValidateSchedule(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if event.Coordinates != nil {
+		if err := event.Coordinates.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	if err := event.ValidateTaxonomy(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	release, err := models.CheckVenueBooking(c, &event)
+	if err != nil {
+		venueBookingFailed(c, err)
+		return
+	}
+	// The venue stays booked for this event until it is stored
+	defer release()
+	if event.Location == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Location or venueId is required"})
+		return
+	}
+
+	// New events are published right away unless saved as a draft
+	switch event.Status {
+	case "", models.EventStatusPublished:
+		event.Status = models.EventStatusPublished
+		now := time.Now().UTC()
+		event.PublishAt = &now
+	case models.EventStatusDraft:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "New events must be draft or published"})
 		return
 	}
 
@@ -45,7 +86,7 @@ func createEvent(c *gin.Context) {
 	event.UserID = userIdObj
 	event.IsAvailable = true
 
-	_, err = models.InsertEvent(&event)
+	_, err = models.InsertEvent(c, &event)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
@@ -56,7 +97,13 @@ func createEvent(c *gin.Context) {
 
 func getEvents(c *gin.Context) {
 
-	event, err := models.GetEvents()
+	filter := models.EventFilter{
+		Category: c.Query("category"),
+		Tag:      strings.ToLower(strings.TrimSpace(c.Query("tag"))),
+		ViewerID: c.GetString("userId"),
+	}
+
+	event, err := models.GetEvents(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch event"})
 		fmt.Println(err)
@@ -67,12 +114,25 @@ func getEvents(c *gin.Context) {
 
 func getEventByID(c *gin.Context) {
 	eventId := c.Param("id")
+	if c.GetBool("ics") {
+		eventICS(c, eventId)
+		return
+	}
+
 	event, err := models.GetEventById(eventId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch event"})
 		fmt.Println(err)
 		return
 	}
+	// Drafts are hidden from everyone but their owner
+	if event == nil || !event.IsVisibleTo(c.GetString("userId")) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Event not found"})
+		return
+	}
+	if notModified(c, event.Version) {
+		return
+	}
 	c.JSON(http.StatusOK, event)
 }
 
@@ -81,12 +141,55 @@ func updateEvent(c *gin.Context) {
 	eventId := c.Param("id")
 
 	// Parse update data from request body
-	var updateData bson.M
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request data"})
+	var request updateEventRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+	if request.PublishAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Use POST /events/:id/publish to schedule publishing"})
+		return
+	}
+	updateData := request.updateData()
+	if len(updateData) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Nothing to update"})
+		return
+	}
+
+	// Schedule changes are validated against the rest of the stored schedule
+	event, ok := eventForOwner(c)
+	if !ok {
+		return
+	}
+	if preconditionFailed(c, event.Version) {
+		return
+	}
+
+	if err := models.ApplyScheduleUpdate(event, updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := models.ApplyCoordinatesUpdate(updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := models.ApplyTaxonomyUpdate(event, updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	release, err := models.ApplyVenueUpdate(c, event, updateData)
+	if err != nil {
+		venueBookingFailed(c, err)
+		return
+	}
+	defer release()
+
+	// Only apply the update to the version it was validated against
+	updatedEvent, err := models.UpdateEventAtVersion(c, eventId, event.Version, updateData)
+	if err == models.ErrVersionConflict {
+		versionConflict(c, err)
 		return
 	}
-	updatedEvent, err := models.UpdateEvent(eventId, updateData)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch event"})
 		fmt.Println(err)
@@ -96,13 +199,95 @@ func updateEvent(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Event not found"})
 		return
 	}
+
+	// A new capacity can fill the event or free places
+	if _, ok := updateData["capacity"]; ok {
+		if err := models.SyncEventAvailability(c, updatedEvent); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	c.Header("ETag", versionETag(updatedEvent.Version))
 	c.JSON(http.StatusOK, gin.H{"message": "event updated", "event": updatedEvent})
 }
 
+// updateEventRequest is what updating an event takes. Only the fields in the
+// request are changed, and they follow the rules of models.Event. Status changes go through the publish and cancel
+// endpoints, and the organizer can't be changed.
+type updateEventRequest struct {
+	Name        *string                   `json:"name" binding:"omitempty,notblank,max=200"`
+	Description *string                   `json:"description" binding:"omitempty,min=1,max=5000"`
+	Location    *string                   `json:"location"`
+	VenueID     nullable[string]          `json:"venueId"` // Null moves the event away from its venue
+	Capacity    *int                      `json:"capacity" binding:"omitempty,min=0"`
+	Coordinates nullable[models.GeoPoint] `json:"coordinates"` // Null removes them
+	DateTime    *time.Time                `json:"dateTime" binding:"omitempty,future"`
+	EndDateTime *time.Time                `json:"endDateTime"`
+	TimeZone    *string                   `json:"timeZone"`
+	Category    *string                   `json:"category"`
+	Tags        *[]string                 `json:"tags"`
+	PublishAt   *time.Time                `json:"publishAt"` // Refused, see publishEvent
+}
+
+// updateData returns the fields of the request as an update, in the form
+// the models.Apply*Update helpers check and rewrite.
+func (r *updateEventRequest) updateData() bson.M {
+	updateData := bson.M{}
+	if r.Name != nil {
+		updateData["name"] = *r.Name
+	}
+	if r.Description != nil {
+		updateData["description"] = *r.Description
+	}
+	if r.Location != nil {
+		updateData["location"] = *r.Location
+	}
+	if r.VenueID.Set {
+		updateData["venueId"] = r.VenueID.value()
+	}
+	if r.Capacity != nil {
+		updateData["capacity"] = *r.Capacity
+	}
+	if r.Coordinates.Set {
+		updateData["coordinates"] = r.Coordinates.value()
+	}
+	if r.DateTime != nil {
+		updateData["dateTime"] = *r.DateTime
+	}
+	if r.EndDateTime != nil {
+		updateData["endDateTime"] = *r.EndDateTime
+	}
+	if r.TimeZone != nil {
+		updateData["timeZone"] = *r.TimeZone
+	}
+	if r.Category != nil {
+		updateData["category"] = *r.Category
+	}
+	if r.Tags != nil {
+		updateData["tags"] = *r.Tags
+	}
+	return updateData
+}
+
 func deleteEvent(c *gin.Context) {
-	eventId := c.Param("id")
+	event, ok := eventForOwner(c)
+	if !ok {
+		return
+	}
+
+	// Events people registered for are cancelled instead, so they get told
+	active, err := models.HasActiveRegistrations(event.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch registrations"})
+		fmt.Println(err)
+		return
+	}
+	if active {
+		c.JSON(http.StatusConflict, gin.H{"message": "The event has registrations, cancel it instead"})
+		return
+	}
 
-	_, err := models.DeleteEvent(eventId)
+	_, err = models.DeleteEvent(c, event.ID.Hex())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch user"})
 		fmt.Println(err)
@@ -111,6 +296,105 @@ func deleteEvent(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "event Deleted"})
 }
 
+// venueBookingFailed responds to an error of CheckVenueBooking.
+func venueBookingFailed(c *gin.Context, err error) {
+	switch err {
+	case models.ErrVenueBooked:
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	case models.ErrVenueBusy:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	}
+}
+
+// eventForOwner loads the event in the path and checks that the
+// authenticated user organizes it. It writes the error response itself.
+func eventForOwner(c *gin.Context) (*models.Event, bool) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User ID not found in context"})
+		return nil, false
+	}
+
+	// Assert userId to string
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return nil, false
+	}
+
+	event, err := models.GetEventById(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch event"})
+		fmt.Println(err)
+		return nil, false
+	}
+	if event == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Event not found"})
+		return nil, false
+	}
+	if event.UserID.Hex() != userIdStr {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the event owner can change it"})
+		return nil, false
+	}
+
+	return event, true
+}
+
+// publishEvent publishes a draft now, or at publishAt when one is given.
+func publishEvent(c *gin.Context) {
+	event, ok := eventForOwner(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		PublishAt *time.Time `json:"publishAt"`
+	}
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			validationFailed(c, err)
+			return
+		}
+	}
+
+	published, err := models.PublishEvent(c, event.ID.Hex(), request.PublishAt)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "event published", "event": published})
+}
+
+// cancelEvent cancels an event, keeping it and notifying its registrants.
+func cancelEvent(c *gin.Context) {
+	event, ok := eventForOwner(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			validationFailed(c, err)
+			return
+		}
+	}
+
+	cancelled, err := models.CancelEvent(c, event.ID.Hex(), request.Reason)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "event cancelled", "event": cancelled})
+}
+
 func availableEvents(c *gin.Context) {
 	event, err := models.AvailableEvents()
 	if err != nil {
@@ -120,3 +404,143 @@ func availableEvents(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Available Events fetched", "events": event})
 }
+
+func happeningNowEvents(c *gin.Context) {
+	events, err := models.HappeningNowEvents()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch event"})
+		fmt.Println(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Events happening now fetched", "events": events})
+}
+
+func upcomingEvents(c *gin.Context) {
+	events, err := models.UpcomingEvents()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch event"})
+		fmt.Println(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Upcoming events fetched", "events": events})
+}
+
+// searchEvents backs the frontend search bar: full-text query, availability,
+// location, category and date filters, plus facet counts.
+func searchEvents(c *gin.Context) {
+	search := models.EventSearch{
+		Query:    strings.TrimSpace(c.Query("q")),
+		Location: c.Query("location"),
+		Category: c.Query("category"),
+	}
+
+	if value := c.Query("isAvailable"); value != "" {
+		isAvailable, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid isAvailable"})
+			return
+		}
+		search.IsAvailable = &isAvailable
+	}
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if search.From, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid from, expected RFC 3339"})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if search.To, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid to, expected RFC 3339"})
+			return
+		}
+	}
+
+	search.Page, err = strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if err != nil || search.Page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid page"})
+		return
+	}
+	search.Limit, err = strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	if err != nil || search.Limit < 1 || search.Limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit, must be between 1 and 100"})
+		return
+	}
+
+	result, err := models.SearchEvents(search)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to search events"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Events found",
+		"events":  result.Hits,
+		"total":   result.Total,
+		"facets":  result.Facets,
+		"page":    search.Page,
+		"limit":   search.Limit,
+	})
+}
+
+// nearbyEvents returns events within radius meters of lat/lng, closest first.
+// It can be combined with the isAvailable, from and to filters.
+func nearbyEvents(c *gin.Context) {
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid lat"})
+		return
+	}
+	lng, err := strconv.ParseFloat(c.Query("lng"), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid lng"})
+		return
+	}
+	radius, err := strconv.ParseFloat(c.DefaultQuery("radius", "5000"), 64)
+	if err != nil || radius <= 0 || radius > 100000 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid radius, must be between 0 and 100000 meters"})
+		return
+	}
+
+	search := models.NearbySearch{
+		Point:  models.NewGeoPoint(lat, lng),
+		Radius: radius,
+	}
+
+	if value := c.Query("isAvailable"); value != "" {
+		isAvailable, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid isAvailable"})
+			return
+		}
+		search.IsAvailable = &isAvailable
+	}
+	if value := c.Query("from"); value != "" {
+		if search.From, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid from, expected RFC 3339"})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if search.To, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid to, expected RFC 3339"})
+			return
+		}
+	}
+	search.Limit, err = strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if err != nil || search.Limit < 1 || search.Limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit, must be between 1 and 100"})
+		return
+	}
+
+	events, err := models.NearbyEvents(search)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch event"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Nearby events fetched", "events": events})
+}
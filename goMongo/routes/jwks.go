@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"example.com/goMongo/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// jwks publishes the public keys our tokens can be verified with.
+func jwks(c *gin.Context) {
+	set, err := utils.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to load signing keys"})
+		fmt.Println(err)
+		return
+	}
+
+	// Verifiers may cache the keys for a while, see the rotation steps in
+	// utils/keys.go
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,199 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"example.com/goMongo/config"
+	"example.com/goMongo/models"
+	"example.com/goMongo/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Name authenticator apps show next to the account
+var mfaIssuer = config.String("MFA_ISSUER", "Go Mongo Events")
+
+type mfaCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// currentUser loads the signed in user, answering the request itself when
+// that isn't possible.
+func currentUser(c *gin.Context) (*models.User, bool) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User ID not found in context"})
+		return nil, false
+	}
+
+	// Assert userId to string
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return nil, false
+	}
+
+	user, err := models.GetUserById(userIdStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch user"})
+		fmt.Println(err)
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// enrollMFA starts two-factor enrollment and returns the secret to add to
+// an authenticator app, as text and as otpauth:// URI.
+func enrollMFA(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	secret, err := models.BeginMFAEnrollment(c, user)
+	if err == models.ErrMFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to start two-factor enrollment"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Add the secret to your authenticator app, then confirm with a code",
+		"secret":  secret,
+		"uri":     utils.TOTPProvisioningURI(mfaIssuer, user.Email, secret),
+	})
+}
+
+// confirmMFA enables two-factor authentication with a first code from the
+// authenticator and returns the recovery codes.
+func confirmMFA(c *gin.Context) {
+	var request mfaCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := models.ConfirmMFAEnrollment(c, user, request.Code)
+	switch err {
+	case nil:
+	case models.ErrMFAEnabled:
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	case models.ErrMFANotEnrolled, models.ErrInvalidMFACode:
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to enable two-factor authentication"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled, store the recovery codes somewhere safe",
+		"recoveryCodes": codes,
+	})
+}
+
+// disableMFA turns two-factor authentication off with a current code or a
+// recovery code.
+func disableMFA(c *gin.Context) {
+	var request mfaCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	err := models.DisableMFA(c, user, request.Code)
+	switch err {
+	case nil:
+	case models.ErrMFANotEnabled, models.ErrInvalidMFACode:
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to disable two-factor authentication"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// logInMFA finishes a login started by logIn for a user with two-factor
+// authentication, trading the MFA token and a code for the real token.
+func logInMFA(c *gin.Context) {
+	var request struct {
+		MFAToken string `json:"mfaToken" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	userId, err := utils.VerifyMFAToken(request.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired MFA token, log in again"})
+		return
+	}
+	user, err := models.GetUserById(userId.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to log in"})
+		fmt.Println(err)
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired MFA token, log in again"})
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	key := accountKey(user.Email)
+	if accountLocked(c, key) {
+		return
+	}
+
+	err = models.VerifyMFA(c, user, request.Code)
+	if err == models.ErrInvalidMFACode || err == models.ErrMFANotEnabled {
+		if _, err := utils.RecordFailure(key, loginLockout); err != nil {
+			fmt.Println(err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": models.ErrInvalidMFACode.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to log in"})
+		fmt.Println(err)
+		return
+	}
+	if err := utils.ResetFailures(key); err != nil {
+		fmt.Println(err)
+	}
+
+	token, err := startSession(c, user)
+	if err != nil {
+		fmt.Println(">>>>", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "JWT token generating error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user logged In", "token": token})
+}
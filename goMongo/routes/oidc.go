@@ -0,0 +1,205 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"example.com/goMongo/models"
+	"example.com/goMongo/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// How long a user has to log in at the provider
+const oidcLoginTimeout = 10 * time.Minute
+
+// oidcLogin starts logging in through an OIDC provider with the
+// authorization code flow and PKCE, and redirects to the provider.
+func oidcLogin(c *gin.Context) {
+	authorizationURL, ok := startOIDCLogin(c, primitive.NilObjectID)
+	if !ok {
+		return
+	}
+	c.Redirect(http.StatusFound, authorizationURL)
+}
+
+// linkOIDCProvider starts linking an OIDC provider to the signed in user.
+// The user follows the returned URL to log in at the provider, and the
+// callback links the account they logged in with.
+func linkOIDCProvider(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	authorizationURL, ok := startOIDCLogin(c, user.ID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Log in at the provider to link it", "authorizationUrl": authorizationURL})
+}
+
+// startOIDCLogin stores a new login at the provider in the path and returns
+// the URL to send the user to. It writes the error response itself.
+func startOIDCLogin(c *gin.Context, linkUserId primitive.ObjectID) (string, bool) {
+	provider, ok := utils.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown login provider"})
+		return "", false
+	}
+
+	state, err := utils.RandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to start login"})
+		fmt.Println(err)
+		return "", false
+	}
+	nonce, err := utils.RandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to start login"})
+		fmt.Println(err)
+		return "", false
+	}
+	verifier, challenge, err := utils.NewPKCE()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to start login"})
+		fmt.Println(err)
+		return "", false
+	}
+
+	authorizationURL, err := provider.AuthorizationURL(state, nonce, challenge)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"message": "Login provider is unavailable"})
+		fmt.Println(err)
+		return "", false
+	}
+
+	err = models.SaveOIDCState(&models.OIDCState{
+		State:        state,
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserId,
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginTimeout),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to start login"})
+		fmt.Println(err)
+		return "", false
+	}
+
+	return authorizationURL, true
+}
+
+// oidcCallback finishes a login the provider redirected back from. It
+// trades the code for an ID token, checks it, and logs in as the user the
+// identity belongs to, linking or creating them the first time. Logins
+// started by linkOIDCProvider link the identity to that user instead.
+func oidcCallback(c *gin.Context) {
+	provider, ok := utils.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown login provider"})
+		return
+	}
+
+	// The login is used up even when the provider reports an error
+	state, err := models.TakeOIDCState(c.Query("state"), provider.Name)
+	if err == models.ErrInvalidOIDCState {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to log in"})
+		fmt.Println(err)
+		return
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Login was denied by the provider", "error": providerError})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Missing authorization code"})
+		return
+	}
+
+	idToken, err := provider.Exchange(code, state.CodeVerifier)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"message": "Login provider rejected the login"})
+		fmt.Println(err)
+		return
+	}
+	claims, err := provider.VerifyIDToken(idToken, state.Nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Login provider sent an invalid ID token"})
+		fmt.Println(err)
+		return
+	}
+
+	identity := models.ExternalIdentity{
+		Provider: provider.Name,
+		Issuer:   provider.Issuer,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	if !state.LinkUserID.IsZero() {
+		linkOIDCIdentity(c, state.LinkUserID, identity)
+		return
+	}
+
+	user, err := models.FindOrLinkOIDCUser(c, identity, claims.Name, claims.EmailVerified)
+	if err == models.ErrUnverifiedEmail {
+		c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	}
+	if err == models.ErrOIDCLinkRequired {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to log in"})
+		fmt.Println(err)
+		return
+	}
+
+	// Same as for a password, the provider only passes the first factor
+	if user.IsMFAEnabled() {
+		mfaToken, err := utils.GenerateMFAToken(user.ID)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "JWT token generating error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor code required", "mfaRequired": true, "mfaToken": mfaToken})
+		return
+	}
+
+	token, err := startSession(c, user)
+	if err != nil {
+		fmt.Println(">>>>", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "JWT token generating error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user logged In", "token": token})
+}
+
+// linkOIDCIdentity finishes linking a provider to the user who started it.
+func linkOIDCIdentity(c *gin.Context, userId primitive.ObjectID, identity models.ExternalIdentity) {
+	user, err := models.LinkOIDCIdentity(c, userId, identity)
+	if err == models.ErrIdentityLinked {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to link provider"})
+		fmt.Println(err)
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "provider linked", "identities": user.Identities})
+}
@@ -0,0 +1,130 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"example.com/goMongo/config"
+	"example.com/goMongo/models"
+	"example.com/goMongo/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Reset emails per address, on top of the per IP limit in routes.go
+var passwordResetAccountLimit = utils.PerMinute(config.Int("PASSWORD_RESET_ACCOUNT_PER_MINUTE", 1))
+
+// passwordRejected answers 400 with the broken rules and returns true when
+// err is a password policy error about field.
+func passwordRejected(c *gin.Context, field string, err error) bool {
+	var policyErr *utils.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	fieldErrs := make([]utils.FieldError, len(policyErr.Violations))
+	for i, violation := range policyErr.Violations {
+		fieldErrs[i] = utils.FieldError{Field: field, Rule: violation.Rule, Message: violation.Message}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"message": "Password doesn't meet the password policy",
+		"errors":  fieldErrs,
+	})
+	return true
+}
+
+// changePassword changes the password of the signed in user and logs out
+// their other sessions.
+func changePassword(c *gin.Context) {
+	var request struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	err := models.ChangePassword(c, user, request.CurrentPassword, request.NewPassword)
+	if passwordRejected(c, "newPassword", err) {
+		return
+	}
+	if err == models.ErrWrongPassword {
+		c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to change password"})
+		fmt.Println(err)
+		return
+	}
+
+	if _, err := models.RevokeOtherSessions(c, user.ID, c.GetString("sessionId")); err != nil {
+		fmt.Println(err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed, other sessions were logged out"})
+}
+
+// forgotPassword sends a password reset token. It answers the same whether
+// the address has an account or not.
+func forgotPassword(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+	if !takeAccountToken(c, "passwordReset", request.Email, passwordResetAccountLimit) {
+		return
+	}
+
+	if err := models.RequestPasswordReset(c, request.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to send password reset"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the address has an account, a password reset token was sent to it"})
+}
+
+// resetPassword sets a new password with a token from forgotPassword and
+// logs out every session of the user.
+func resetPassword(c *gin.Context) {
+	var request struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	user, err := models.ResetPassword(c, request.Token, request.Password)
+	if passwordRejected(c, "password", err) {
+		return
+	}
+	if err == models.ErrInvalidResetToken {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to reset password"})
+		fmt.Println(err)
+		return
+	}
+
+	if _, err := models.RevokeOtherSessions(c, user.ID, ""); err != nil {
+		fmt.Println(err)
+	}
+	if err := utils.ResetFailures(accountKey(user.Email)); err != nil {
+		fmt.Println(err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset, log in with the new password"})
+}
@@ -1,12 +1,17 @@
 package routes
 
 import (
+	"encoding/csv"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"example.com/goMongo/models"
+	"example.com/goMongo/utils"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/skip2/go-qrcode"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -44,7 +49,7 @@ func registerEvent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to retrieve event"})
 		return
 	}
-	if event == nil || !event.IsAvailable {
+	if event == nil || !event.IsOpen() {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Event is not available for registration"})
 		return
 	}
@@ -53,17 +58,14 @@ func registerEvent(c *gin.Context) {
 	registration.EventID = eventIdObj
 	registration.UserID = userIdObj
 
-	_, err = models.RegisterEvent(&registration)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	// The event is closed once its capacity is taken
+	_, err = models.RegisterEvent(c, &registration)
+	if err == models.ErrAlreadyRegistered || err == models.ErrEventFull {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
 		return
 	}
-
-	// Update the event to set IsAvailable to false
-	updateData := bson.M{"isAvailable": false}
-	_, err = models.UpdateEvent(eventId, updateData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update event availability"})
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
 
@@ -106,7 +108,11 @@ func registeredEvents(c *gin.Context) {
 func cancelRegistration(c *gin.Context) {
 	registrationId := c.Param("id")
 
-	_, err := models.CancelRegistration(registrationId)
+	_, err := models.CancelRegistration(c, registrationId)
+	if err == models.ErrRegistrationAttended {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch user"})
 		fmt.Println(err)
@@ -114,3 +120,233 @@ func cancelRegistration(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "registration cancelled"})
 }
+
+func eventRegistrations(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User ID not found in context"})
+		return
+	}
+
+	// Assert userId to string
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return
+	}
+
+	eventId := c.Param("id")
+	event, err := models.GetEventById(eventId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to retrieve event"})
+		fmt.Println(err)
+		return
+	}
+	if event == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Event not found"})
+		return
+	}
+
+	// Only the organizer of the event may see who registered for it
+	if event.UserID.Hex() != userIdStr {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the event owner can view its registrations"})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		exportRegistrationsCSV(c, event)
+		return
+	}
+
+	page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid page"})
+		return
+	}
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit, must be between 1 and 100"})
+		return
+	}
+
+	registrations, total, err := models.EventRegistrations(eventId, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch registrations"})
+		fmt.Println(err)
+		return
+	}
+
+	roster := make([]rosterEntry, len(registrations))
+	for i := range registrations {
+		roster[i] = newRosterEntry(&registrations[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Registrations fetched",
+		"registrations": roster,
+		"page":          page,
+		"limit":         limit,
+		"total":         total,
+	})
+}
+
+// rosterEntry is what organizers get to see of an attendee, leaving out
+// everything else stored on the user.
+type rosterEntry struct {
+	ID        primitive.ObjectID `json:"id"`
+	Name      string             `json:"name"`
+	Email     string             `json:"email"`
+	Status    string             `json:"status"`
+	CheckedIn bool               `json:"checkedIn"`
+}
+
+func newRosterEntry(registration *models.Registration) rosterEntry {
+	entry := rosterEntry{
+		ID:        registration.ID,
+		Status:    registration.Status,
+		CheckedIn: registration.CheckedInAt != nil,
+	}
+	if registration.User != nil {
+		entry.Name = registration.User.Name
+		entry.Email = registration.User.Email
+	}
+	return entry
+}
+
+// csvCell keeps spreadsheets from running attendee supplied values as
+// formulas, by prefixing values that start like one with a quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// exportRegistrationsCSV streams the attendee roster of an event as CSV.
+func exportRegistrationsCSV(c *gin.Context, event *models.Event) {
+	filename := fmt.Sprintf("event-%s-registrations.csv", event.ID.Hex())
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"name", "email", "registeredAt", "status"})
+
+	err := models.EachEventRegistration(event.ID.Hex(), func(registration *models.Registration) error {
+		entry := newRosterEntry(registration)
+		row := []string{csvCell(entry.Name), csvCell(entry.Email), registration.CreatedAt.UTC().Format(time.RFC3339), entry.Status}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+		// Flush every row so check-in desks start receiving data right away
+		writer.Flush()
+		return writer.Error()
+	})
+	writer.Flush()
+	if err != nil {
+		// Headers are already sent, so the best we can do is log and stop
+		fmt.Println(err)
+	}
+}
+
+func registrationTicket(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User ID not found in context"})
+		return
+	}
+
+	// Assert userId to string
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return
+	}
+
+	registration, err := models.GetRegistrationById(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to retrieve registration"})
+		fmt.Println(err)
+		return
+	}
+	if registration == nil || registration.UserID.Hex() != userIdStr {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Registration not found"})
+		return
+	}
+
+	png, err := qrcode.Encode(registration.TicketCode, qrcode.Medium, 256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to render ticket"})
+		fmt.Println(err)
+		return
+	}
+
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+func checkIn(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User ID not found in context"})
+		return
+	}
+
+	// Assert userId to string
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return
+	}
+
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	// Reject forged or mistyped codes before touching the database
+	registrationId, ticketEventId, err := utils.VerifyTicketCode(request.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid ticket"})
+		return
+	}
+
+	eventId := c.Param("id")
+	if ticketEventId.Hex() != eventId {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Ticket is for a different event"})
+		return
+	}
+
+	event, err := models.GetEventById(eventId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to retrieve event"})
+		fmt.Println(err)
+		return
+	}
+	if event == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Event not found"})
+		return
+	}
+	if event.UserID.Hex() != userIdStr {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the event owner can check in attendees"})
+		return
+	}
+
+	registration, err := models.CheckInRegistration(c, registrationId, ticketEventId)
+	if err == models.ErrAlreadyCheckedIn {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if registration == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Registration not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "checked in", "registration": registration})
+}
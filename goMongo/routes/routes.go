@@ -1,27 +1,93 @@
 package routes
 
 import (
+	"example.com/goMongo/config"
 	"example.com/goMongo/middlewares"
+	"example.com/goMongo/utils"
 	"github.com/gin-gonic/gin"
 )
 
 func RegisterRoutes(server *gin.Engine) {
-	server.POST("/signup", signUp)
-	server.POST("/login", logIn)
+	registerValidators()
+	server.Use(middlewares.RequestContext)
+
+	// Path parameters that name a document have to be ObjectIDs
+	objectID := middlewares.ObjectIDParams("id")
+
+	server.GET("/.well-known/jwks.json", jwks)
+	server.POST("/signup", middlewares.RateLimit("signup", utils.PerMinute(config.Int("SIGNUP_IP_PER_MINUTE", 5))), middlewares.Idempotent, signUp)
+	loginLimit := middlewares.RateLimit("login", utils.PerMinute(config.Int("LOGIN_IP_PER_MINUTE", 20)))
+	server.POST("/login", loginLimit, logIn)
+	server.POST("/login/mfa", loginLimit, logInMFA)
+	server.GET("/login/oidc/:provider", loginLimit, oidcLogin)
+	server.GET("/login/oidc/:provider/callback", loginLimit, oidcCallback)
+	passwordResetLimit := middlewares.RateLimit("passwordReset", utils.PerMinute(config.Int("PASSWORD_RESET_IP_PER_MINUTE", 5)))
+	server.POST("/password/forgot", passwordResetLimit, forgotPassword)
+	server.POST("/password/reset", passwordResetLimit, resetPassword)
 	server.GET("/getUser", middlewares.Authenticate, getUser)
 	server.GET("/getAllUsers", middlewares.Authenticate, getAllUser)
 	server.PUT("/updateUser", middlewares.Authenticate, updateUser)
 	server.DELETE("/deleteUser", middlewares.Authenticate, deleteUser)
+	server.PUT("/users/me/password", middlewares.Authenticate, changePassword)
+	server.GET("/users/me/calendar", middlewares.Authenticate, calendarLink)
+	server.POST("/users/me/calendar/rotate", middlewares.Authenticate, rotateCalendarLink)
+	server.DELETE("/users/me/calendar", middlewares.Authenticate, revokeCalendarLink)
+	server.GET("/users/me/calendar.ics", calendarFeed)
+	server.POST("/users/me/mfa", middlewares.Authenticate, enrollMFA)
+	server.POST("/users/me/mfa/confirm", middlewares.Authenticate, confirmMFA)
+	server.DELETE("/users/me/mfa", middlewares.Authenticate, disableMFA)
+	server.POST("/users/me/apikeys", middlewares.Authenticate, createAPIKey)
+	server.GET("/users/me/apikeys", middlewares.Authenticate, listAPIKeys)
+	server.DELETE("/users/me/apikeys/:id", middlewares.Authenticate, objectID, revokeAPIKey)
+	server.POST("/users/me/identities/:provider", middlewares.Authenticate, linkOIDCProvider)
+	server.GET("/users/me/sessions", middlewares.Authenticate, listSessions)
+	server.DELETE("/users/me/sessions/:id", middlewares.Authenticate, revokeSession)
 
 	// Event Routes
 
-	server.POST("/events", middlewares.Authenticate, createEvent)
-	server.GET("/events", getEvents)
+	server.POST("/events", middlewares.Authenticate, middlewares.Idempotent, createEvent)
+	server.GET("/events", middlewares.OptionalAuthenticate, getEvents)
 	server.GET("/events/availableEvents", availableEvents)
-	server.GET("/events/:id", getEventByID)
-	server.PUT("/events/:id", updateEvent)
-	server.DELETE("/events/:id", deleteEvent)
-	server.POST("/events/:id/register", middlewares.Authenticate, registerEvent)
+	server.GET("/events/happeningNow", happeningNowEvents)
+	server.GET("/events/upcoming", upcomingEvents)
+	server.GET("/events/search", searchEvents)
+	server.GET("/events/nearby", nearbyEvents)
+	server.GET("/events/:id", middlewares.OptionalAuthenticate, calendarSuffix, objectID, getEventByID)
+	server.PUT("/events/:id", middlewares.Authenticate, objectID, updateEvent)
+	server.DELETE("/events/:id", middlewares.Authenticate, objectID, deleteEvent)
+	server.POST("/events/:id/publish", middlewares.Authenticate, objectID, publishEvent)
+	server.POST("/events/:id/cancel", middlewares.Authenticate, objectID, cancelEvent)
+	server.POST("/events/:id/register", middlewares.Authenticate, objectID, middlewares.Idempotent, registerEvent)
 	server.GET("/events/registered", middlewares.Authenticate, registeredEvents)
-	server.DELETE("events/:id/cancelRegistration", middlewares.Authenticate, cancelRegistration)
+	server.GET("/events/:id/registrations", middlewares.Authenticate, objectID, eventRegistrations)
+	server.POST("/events/:id/checkin", middlewares.Authenticate, objectID, checkIn)
+	server.GET("/registrations/:id/ticket", middlewares.Authenticate, objectID, registrationTicket)
+	server.DELETE("events/:id/cancelRegistration", middlewares.Authenticate, objectID, cancelRegistration)
+
+	// Admin Routes
+	admin := server.Group("/admin", middlewares.Authenticate, middlewares.RequireAdmin)
+	admin.GET("/deleted/:kind", listDeleted)
+	admin.POST("/deleted/:kind/:id/restore", objectID, restoreDeleted)
+
+	server.GET("/audit", middlewares.Authenticate, middlewares.RequireAdmin, listAudit)
+
+	// Category Routes
+	server.GET("/categories", getCategories)
+	server.POST("/categories", middlewares.Authenticate, middlewares.RequireAdmin, createCategory)
+	server.PUT("/categories/:slug", middlewares.Authenticate, middlewares.RequireAdmin, updateCategory)
+	server.DELETE("/categories/:slug", middlewares.Authenticate, middlewares.RequireAdmin, deleteCategory)
+
+	// Venue Routes
+	server.POST("/venues", middlewares.Authenticate, createVenue)
+	server.GET("/venues", getVenues)
+	server.GET("/venues/:id", objectID, getVenueByID)
+	server.PUT("/venues/:id", middlewares.Authenticate, objectID, updateVenue)
+	server.DELETE("/venues/:id", middlewares.Authenticate, objectID, deleteVenue)
+
+	// Recurring event series
+	server.POST("/series", middlewares.Authenticate, createSeries)
+	server.GET("/series/:id", objectID, getSeriesByID)
+	server.GET("/series/:id/occurrences", objectID, seriesOccurrences)
+	server.PUT("/series/:id", middlewares.Authenticate, objectID, updateSeries)
+	server.POST("/series/:id/exceptions", middlewares.Authenticate, objectID, addSeriesException)
 }
@@ -0,0 +1,263 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"example.com/goMongo/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxOccurrenceWindow caps how far a single expansion request may reach.
+const maxOccurrenceWindow = 366 * 24 * time.Hour
+
+func createSeries(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User ID not found in context"})
+		return
+	}
+
+	// Assert userId to string
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return
+	}
+
+	// Convert the userIdStr to primitive.ObjectID
+	userIdObj, err := primitive.ObjectIDFromHex(userIdStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return
+	}
+
+	var series models.EventSeries
+	if err := c.ShouldBindJSON(&series); err != nil {
+		validationFailed(c, err)
+		return
+	}
+	if err := series.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Exceptions are added one occurrence at a time once the series exists
+	series.Exceptions = nil
+	series.UserID = userIdObj
+
+	if _, err := models.InsertSeries(&series); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to create series"})
+		fmt.Println(err)
+		return
+	}
+	// The materializer job catches up on occurrences this misses
+	if err := models.MaterializeUpcoming(c, &series); err != nil {
+		fmt.Println(err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "series created successfully", "series": series})
+}
+
+func getSeriesByID(c *gin.Context) {
+	series, err := models.GetSeriesById(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch series"})
+		fmt.Println(err)
+		return
+	}
+	if series == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Series not found"})
+		return
+	}
+	c.JSON(http.StatusOK, series)
+}
+
+// seriesOccurrences lists the occurrences of a series between the from and
+// to query parameters (RFC 3339). Occurrences that were materialized carry
+// the ID of their event, which is registered for like any other.
+func seriesOccurrences(c *gin.Context) {
+	series, err := models.GetSeriesById(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch series"})
+		fmt.Println(err)
+		return
+	}
+	if series == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Series not found"})
+		return
+	}
+
+	from := time.Now().UTC()
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid from, expected RFC 3339"})
+			return
+		}
+	}
+	to := from.AddDate(0, 3, 0)
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid to, expected RFC 3339"})
+			return
+		}
+	}
+	if !to.After(from) || to.Sub(from) > maxOccurrenceWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "to must be after from and at most a year later"})
+		return
+	}
+
+	occurrences, err := models.SeriesOccurrences(series, from.UTC(), to.UTC())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to expand series"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Occurrences fetched", "occurrences": occurrences})
+}
+
+// seriesForOwner loads the series in the path and checks that the
+// authenticated user organizes it. It writes the error response itself.
+func seriesForOwner(c *gin.Context) (*models.EventSeries, bool) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User ID not found in context"})
+		return nil, false
+	}
+
+	// Assert userId to string
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return nil, false
+	}
+
+	series, err := models.GetSeriesById(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch series"})
+		fmt.Println(err)
+		return nil, false
+	}
+	if series == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Series not found"})
+		return nil, false
+	}
+	if series.UserID.Hex() != userIdStr {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the series owner can change it"})
+		return nil, false
+	}
+
+	return series, true
+}
+
+func addSeriesException(c *gin.Context) {
+	series, ok := seriesForOwner(c)
+	if !ok {
+		return
+	}
+
+	var exception models.SeriesException
+	if err := c.ShouldBindJSON(&exception); err != nil {
+		validationFailed(c, err)
+		return
+	}
+	if !exception.Cancelled && exception.DateTime == nil && exception.EndDateTime == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "An exception must cancel or reschedule the occurrence"})
+		return
+	}
+
+	updated, err := models.AddSeriesException(c, series, exception)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "series exception saved", "series": updated})
+}
+
+// updateSeriesRequest is what updating a series takes. Fields that are set
+// follow the rules of models.EventSeries.
+type updateSeriesRequest struct {
+	Name        *string    `json:"name" binding:"omitempty,notblank,max=200"`
+	Description *string    `json:"description" binding:"omitempty,min=1,max=5000"`
+	Location    *string    `json:"location" binding:"omitempty,notblank,max=200"`
+	DateTime    *time.Time `json:"dateTime"`
+	EndDateTime *time.Time `json:"endDateTime"`
+	TimeZone    *string    `json:"timeZone"`
+	RRule       *string    `json:"rrule" binding:"omitempty,notblank"`
+}
+
+// updateSeries changes a whole series, or with ?from=<occurrence start> only
+// that occurrence and the ones following it.
+func updateSeries(c *gin.Context) {
+	series, ok := seriesForOwner(c)
+	if !ok {
+		return
+	}
+
+	var request updateSeriesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	var from time.Time
+	if value := c.Query("from"); value != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid from, expected RFC 3339"})
+			return
+		}
+	}
+
+	updated := *series
+	if !from.IsZero() && !from.Equal(series.DateTime) {
+		// The new series starts at the chosen occurrence unless told otherwise
+		updated.DateTime = from.UTC()
+		updated.EndDateTime = from.UTC().Add(series.EndDateTime.Sub(series.DateTime))
+	}
+	if request.Name != nil {
+		updated.Name = *request.Name
+	}
+	if request.Description != nil {
+		updated.Description = *request.Description
+	}
+	if request.Location != nil {
+		updated.Location = *request.Location
+	}
+	if request.DateTime != nil {
+		duration := updated.EndDateTime.Sub(updated.DateTime)
+		updated.DateTime = *request.DateTime
+		updated.EndDateTime = request.DateTime.Add(duration)
+	}
+	if request.EndDateTime != nil {
+		updated.EndDateTime = *request.EndDateTime
+	}
+	if request.TimeZone != nil {
+		updated.TimeZone = *request.TimeZone
+	}
+	if request.RRule != nil {
+		updated.RRule = *request.RRule
+	}
+
+	if from.IsZero() || from.Equal(series.DateTime) {
+		result, err := models.UpdateSeries(c, &updated)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "series updated", "series": result})
+		return
+	}
+
+	original, following, err := models.SplitSeries(c, series, &updated, from)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "series updated from " + from.UTC().Format(time.RFC3339), "series": original, "followingSeries": following})
+}
@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/goMongo/models"
+	"example.com/goMongo/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Longest device name a client can give itself
+const maxDeviceNameLength = 100
+
+// startSession records a session for a login from this request and returns
+// the access token for it. Clients can name the device in X-Device-Name,
+// otherwise it is described from the user agent.
+func startSession(c *gin.Context, user *models.User) (string, error) {
+	device := strings.TrimSpace(c.GetHeader("X-Device-Name"))
+	if device == "" {
+		device = utils.DescribeUserAgent(c.Request.UserAgent())
+	}
+	if len(device) > maxDeviceNameLength {
+		device = device[:maxDeviceNameLength]
+	}
+
+	session := models.Session{
+		UserID:    user.ID,
+		Device:    device,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		ExpiresAt: time.Now().UTC().Add(utils.AccessTokenTTL()),
+	}
+	if err := models.CreateSession(c, &session); err != nil {
+		return "", err
+	}
+
+	return utils.GenerateToken(user.Email, user.ID, session.ID.Hex())
+}
+
+// listSessions lists the devices the user is logged in on.
+func listSessions(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := models.GetSessions(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch sessions"})
+		fmt.Println(err)
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == c.GetString("sessionId")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions fetched", "sessions": sessions})
+}
+
+// revokeSession logs out one session, or with "others" as the ID every
+// session except the one making the request.
+func revokeSession(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if c.Param("id") == "others" {
+		count, err := models.RevokeOtherSessions(c, user.ID, c.GetString("sessionId"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to revoke sessions"})
+			fmt.Println(err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked", "revoked": count})
+		return
+	}
+
+	err := models.RevokeSession(c, user.ID, c.Param("id"))
+	if err == models.ErrSessionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to revoke session"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
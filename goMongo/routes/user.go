@@ -3,22 +3,110 @@ package routes
 import (
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"example.com/goMongo/config"
+	"example.com/goMongo/middlewares"
 	"example.com/goMongo/models"
 	"example.com/goMongo/utils"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// Limits per email address, on top of the per IP limits in routes.go
+var (
+	loginAccountLimit  = utils.PerMinute(config.Int("LOGIN_ACCOUNT_PER_MINUTE", 5))
+	signupAccountLimit = utils.PerMinute(config.Int("SIGNUP_ACCOUNT_PER_MINUTE", 3))
+	loginLockout       = utils.LockoutPolicy{
+		MaxFailures: config.Int("LOGIN_MAX_FAILURES", 5),
+		Window:      config.Duration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		Duration:    config.Duration("LOGIN_LOCKOUT", 15*time.Minute),
+	}
+)
+
+// accountKey identifies the account an email belongs to in the limiter,
+// whether or not the account exists.
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// accountLocked answers 429 and returns true while the account is locked.
+// Locked accounts get this answer whether the password is right or not,
+// otherwise the lockout wouldn't slow down guessing.
+func accountLocked(c *gin.Context, key string) bool {
+	lockedUntil, err := utils.LockedUntil(key)
+	if err != nil {
+		fmt.Println(err)
+	}
+	if time.Now().Before(lockedUntil) {
+		middlewares.TooManyRequests(c, time.Until(lockedUntil))
+		return true
+	}
+	return false
+}
+
+// takeAccountToken applies limit to the account of email. It answers 429
+// and returns false when the account is over the limit.
+func takeAccountToken(c *gin.Context, name, email string, limit utils.RateLimit) bool {
+	allowed, retryAfter, err := utils.TakeToken(name+":"+accountKey(email), limit)
+	if err != nil {
+		fmt.Println(err)
+		return true
+	}
+	if !allowed {
+		middlewares.TooManyRequests(c, retryAfter)
+	}
+	return allowed
+}
+
+// signUpRequest is what signing up takes. InsertUser checks the password
+// against the password policy.
+type signUpRequest struct {
+	Name     string `json:"name" form:"name" binding:"required,notblank,max=100"`
+	Email    string `json:"email" form:"email" binding:"required,email,max=254"`
+	Password string `json:"password" form:"password" binding:"required"`
+}
+
+// updateUserRequest is what updating a profile takes. Only the fields in
+// the request are changed, everything else has its own endpoint.
+type updateUserRequest struct {
+	Name  *string `json:"name" binding:"omitempty,notblank,max=100"`
+	Email *string `json:"email" binding:"omitempty,email,max=254"`
+}
+
+func (r *updateUserRequest) updateData() bson.M {
+	updateData := bson.M{}
+	if r.Name != nil {
+		updateData["name"] = *r.Name
+	}
+	if r.Email != nil {
+		updateData["email"] = *r.Email
+	}
+	return updateData
+}
+
+type logInRequest struct {
+	Email    string `json:"email" form:"email" binding:"required,email"`
+	Password string `json:"password" form:"password" binding:"required"`
+}
+
 func signUp(c *gin.Context) {
-	var user models.User
-	err := c.ShouldBind(&user)
+	var request signUpRequest
+	err := c.ShouldBind(&request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		validationFailed(c, err)
+		return
+	}
+	user := models.User{Name: request.Name, Email: request.Email, Password: request.Password}
+	if !takeAccountToken(c, "signup", user.Email, signupAccountLimit) {
 		return
 	}
 
-	result, err := models.InsertUser(&user)
+	result, err := models.InsertUser(c, &user)
+	if passwordRejected(c, "password", err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
@@ -26,7 +114,7 @@ func signUp(c *gin.Context) {
 
 	fmt.Println("Inserted user with ID:", result.InsertedID)
 
-	token, err := utils.GenerateToken(user.Email, user.ID)
+	token, err := startSession(c, &user)
 	if err != nil {
 		fmt.Println(">>>>", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "JWT token generating error"})
@@ -36,19 +124,54 @@ func signUp(c *gin.Context) {
 }
 
 func logIn(c *gin.Context) {
-	var user models.User
-	err := c.ShouldBind(&user)
+	var request logInRequest
+	err := c.ShouldBind(&request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		validationFailed(c, err)
+		return
+	}
+	user := models.User{Email: request.Email, Password: request.Password}
+
+	key := accountKey(user.Email)
+	if accountLocked(c, key) {
 		return
 	}
+	if !takeAccountToken(c, "login", user.Email, loginAccountLimit) {
+		return
+	}
+
 	err = user.ValidateCredentials()
+	if err == models.ErrInvalidCredentials {
+		if _, err := utils.RecordFailure(key, loginLockout); err != nil {
+			fmt.Println(err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": models.ErrInvalidCredentials.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to log in"})
+		fmt.Println(err)
+		return
+	}
+
+	// The password alone isn't enough, POST /login/mfa finishes the login.
+	// Failures are only forgotten once the second factor passed too.
+	if user.IsMFAEnabled() {
+		mfaToken, err := utils.GenerateMFAToken(user.ID)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "JWT token generating error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor code required", "mfaRequired": true, "mfaToken": mfaToken})
 		return
 	}
 
-	token, err := utils.GenerateToken(user.Email, user.ID)
+	if err := utils.ResetFailures(key); err != nil {
+		fmt.Println(err)
+	}
+
+	token, err := startSession(c, &user)
 
 	if err != nil {
 		fmt.Println(">>>>", err)
@@ -90,6 +213,9 @@ func getUser(c *gin.Context) {
 		fmt.Println(err)
 		return
 	}
+	if user != nil && notModified(c, user.Version) {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "User fetched", "user": user})
 }
 
@@ -108,14 +234,37 @@ func updateUser(c *gin.Context) {
 	}
 
 	// Parse update data from request body
-	var updateData bson.M
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request data"})
+	var request updateUserRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationFailed(c, err)
+		return
+	}
+	updateData := request.updateData()
+	if len(updateData) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Nothing to update"})
+		return
+	}
+
+	user, err := models.GetUserById(userIdStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch user"})
+		fmt.Println(err)
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return
+	}
+	if preconditionFailed(c, user.Version) {
 		return
 	}
 
-	// Call the UpdateUserById function
-	updatedUser, err := models.UpdateUserById(userIdStr, updateData)
+	// Call the UpdateUserByIdAtVersion function
+	updatedUser, err := models.UpdateUserByIdAtVersion(c, userIdStr, user.Version, updateData)
+	if err == models.ErrVersionConflict {
+		versionConflict(c, err)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		fmt.Println(err)
@@ -126,6 +275,7 @@ func updateUser(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", versionETag(updatedUser.Version))
 	c.JSON(http.StatusOK, updatedUser)
 }
 
@@ -142,9 +292,28 @@ func deleteUser(c *gin.Context) {
 		return
 	}
 
-	_, err := models.DeleteUser(userIdStr)
+	// Events of the deleted user go to transferTo, or are cancelled without
+	// it. Handing events to another account needs an admin, since its owner
+	// isn't asked.
+	transferTo := c.Query("transferTo")
+	if transferTo != "" {
+		user, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		if user.Role != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Only admins can transfer events to another account"})
+			return
+		}
+	}
+
+	_, err := models.DeleteUser(c, userIdStr, transferTo)
+	if err == models.ErrTransferTarget {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch user"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to delete user"})
 		fmt.Println(err)
 		return
 	}
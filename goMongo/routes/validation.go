@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"example.com/goMongo/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// registerValidators adds our rules to the validator gin binds requests with.
+func registerValidators() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := utils.RegisterValidators(v); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// validationFailed answers 400 with everything wrong with a request that
+// failed to bind.
+func validationFailed(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request data", "errors": utils.ValidationErrors(err)})
+}
+
+// nullable is a request field that tells a missing value apart from null,
+// for fields an update can remove.
+type nullable[T any] struct {
+	Set   bool // The field was in the request
+	Value *T   // Nil when the field was null
+}
+
+func (n *nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Value = nil
+		return nil
+	}
+	n.Value = new(T)
+	return json.Unmarshal(data, n.Value)
+}
+
+// value is the field as it goes into an update, nil for null.
+func (n nullable[T]) value() interface{} {
+	if n.Value == nil {
+		return nil
+	}
+	return *n.Value
+}
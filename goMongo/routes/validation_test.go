@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/goMongo/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// bindJSON binds body the way the handlers do.
+func bindJSON(t *testing.T, body string, request interface{}) error {
+	t.Helper()
+	registerValidators()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return c.ShouldBindJSON(request)
+}
+
+func TestUpdateUserRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    bson.M
+		wantErr bool
+	}{
+		{"name only", `{"name": "Ada"}`, bson.M{"name": "Ada"}, false},
+		{"email only", `{"email": "ada@example.com"}`, bson.M{"email": "ada@example.com"}, false},
+		{"protected fields are dropped", `{"name": "Ada", "role": "admin", "deletedAt": null, "password": "x", "emailVerified": true}`, bson.M{"name": "Ada"}, false},
+		{"nothing", `{}`, bson.M{}, false},
+		{"invalid email", `{"email": "ada"}`, nil, true},
+		{"blank name", `{"name": "  "}`, nil, true},
+		{"long name", `{"name": "` + strings.Repeat("a", 101) + `"}`, nil, true},
+		{"wrong type", `{"name": 5}`, nil, true},
+	}
+	for _, test := range tests {
+		var request updateUserRequest
+		err := bindJSON(t, test.body, &request)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: bind error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(request.updateData(), test.want) {
+			t.Errorf("%s: updateData = %v, want %v", test.name, request.updateData(), test.want)
+		}
+	}
+}
+
+func TestUpdateEventRequest(t *testing.T) {
+	start := time.Date(2030, 5, 1, 18, 0, 0, 0, time.UTC)
+	point := models.GeoPoint{Type: "Point", Coordinates: [2]float64{4.9, 52.37}}
+
+	tests := []struct {
+		name    string
+		body    string
+		want    bson.M
+		wantErr bool
+	}{
+		{"name and schedule", `{"name": "Jazz", "dateTime": "2030-05-01T18:00:00Z"}`, bson.M{"name": "Jazz", "dateTime": start}, false},
+		{"status, owner and deletion are dropped", `{"description": "New", "status": "cancelled", "userId": "64b7f0c2a1b2c3d4e5f60718", "deletedAt": "2030-01-01T00:00:00Z", "isAvailable": false}`, bson.M{"description": "New"}, false},
+		{"venue set", `{"venueId": "64b7f0c2a1b2c3d4e5f60718", "capacity": 40}`, bson.M{"venueId": "64b7f0c2a1b2c3d4e5f60718", "capacity": 40}, false},
+		{"venue removed", `{"venueId": null}`, bson.M{"venueId": nil}, false},
+		{"coordinates set", `{"coordinates": {"type": "Point", "coordinates": [4.9, 52.37]}}`, bson.M{"coordinates": point}, false},
+		{"coordinates removed", `{"coordinates": null}`, bson.M{"coordinates": nil}, false},
+		{"taxonomy", `{"category": "music", "tags": ["jazz", "live"]}`, bson.M{"category": "music", "tags": []string{"jazz", "live"}}, false},
+		{"nothing", `{}`, bson.M{}, false},
+		{"blank name", `{"name": ""}`, nil, true},
+		{"empty description", `{"description": ""}`, nil, true},
+		{"start in the past", `{"dateTime": "2020-05-01T18:00:00Z"}`, nil, true},
+		{"negative capacity", `{"capacity": -1}`, nil, true},
+		{"fractional capacity", `{"capacity": 1.5}`, nil, true},
+		{"malformed time", `{"dateTime": "tomorrow"}`, nil, true},
+	}
+	for _, test := range tests {
+		var request updateEventRequest
+		err := bindJSON(t, test.body, &request)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: bind error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(request.updateData(), test.want) {
+			t.Errorf("%s: updateData = %#v, want %#v", test.name, request.updateData(), test.want)
+		}
+	}
+
+	var request updateEventRequest
+	if err := bindJSON(t, `{"publishAt": "2030-01-01T00:00:00Z"}`, &request); err != nil || request.PublishAt == nil {
+		t.Errorf("publishAt wasn't bound to be refused: %v", err)
+	}
+}
+
+func TestUpdateSeriesRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{"name and rule", `{"name": "Weekly jazz", "rrule": "FREQ=WEEKLY;BYDAY=TU"}`, false},
+		{"nothing", `{}`, false},
+		{"blank name", `{"name": " "}`, true},
+		{"long name", `{"name": "` + strings.Repeat("a", 201) + `"}`, true},
+		{"empty description", `{"description": ""}`, true},
+		{"long description", `{"description": "` + strings.Repeat("a", 5001) + `"}`, true},
+		{"blank location", `{"location": ""}`, true},
+		{"blank rule", `{"rrule": ""}`, true},
+	}
+	for _, test := range tests {
+		var request updateSeriesRequest
+		if err := bindJSON(t, test.body, &request); (err != nil) != test.wantErr {
+			t.Errorf("%s: bind error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
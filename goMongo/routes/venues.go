@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"example.com/goMongo/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func createVenue(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User ID not found in context"})
+		return
+	}
+
+	// Assert userId to string
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return
+	}
+
+	// Convert the userIdStr to primitive.ObjectID
+	userIdObj, err := primitive.ObjectIDFromHex(userIdStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return
+	}
+
+	var venue models.Venue
+	if err := c.ShouldBindJSON(&venue); err != nil {
+		validationFailed(c, err)
+		return
+	}
+	if err := venue.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	venue.ID = primitive.NilObjectID
+	venue.UserID = userIdObj
+
+	if _, err := models.InsertVenue(&venue); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to create venue"})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "venue created successfully", "venue": venue})
+}
+
+func getVenues(c *gin.Context) {
+	venues, err := models.GetVenues()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch venues"})
+		fmt.Println(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Venues fetched", "venues": venues})
+}
+
+func getVenueByID(c *gin.Context) {
+	venue, err := models.GetVenueById(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch venue"})
+		fmt.Println(err)
+		return
+	}
+	if venue == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Venue not found"})
+		return
+	}
+	c.JSON(http.StatusOK, venue)
+}
+
+// venueForOwner loads the venue in the path and checks that the
+// authenticated user owns it. It writes the error response itself.
+func venueForOwner(c *gin.Context) (*models.Venue, bool) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User ID not found in context"})
+		return nil, false
+	}
+
+	// Assert userId to string
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID format is invalid"})
+		return nil, false
+	}
+
+	venue, err := models.GetVenueById(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to fetch venue"})
+		fmt.Println(err)
+		return nil, false
+	}
+	if venue == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Venue not found"})
+		return nil, false
+	}
+	if venue.UserID.Hex() != userIdStr {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the venue owner can change it"})
+		return nil, false
+	}
+
+	return venue, true
+}
+
+func updateVenue(c *gin.Context) {
+	venue, ok := venueForOwner(c)
+	if !ok {
+		return
+	}
+
+	// Fields missing from the body keep their stored values
+	updated := *venue
+	if err := c.ShouldBindJSON(&updated); err != nil {
+		validationFailed(c, err)
+		return
+	}
+	updated.ID = venue.ID
+	updated.UserID = venue.UserID
+
+	result, err := models.UpdateVenue(c, &updated)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "venue updated", "venue": result})
+}
+
+func deleteVenue(c *gin.Context) {
+	venue, ok := venueForOwner(c)
+	if !ok {
+		return
+	}
+
+	if _, err := models.DeleteVenue(venue.ID.Hex()); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "venue Deleted"})
+}
@@ -1,13 +1,251 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	"example.com/goMongo/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passwords are hashed with PASSWORD_HASHER, argon2id (default) or bcrypt.
+// Hashes name their algorithm and parameters, so hashes made with either
+// keep working, and ValidateCredentials rehashes them once the algorithm or
+// its parameters change:
+//
+//	PASSWORD_ARGON2_MEMORY   Memory in KiB, 19456 by default
+//	PASSWORD_ARGON2_TIME     Iterations, 2 by default
+//	PASSWORD_ARGON2_THREADS  Parallelism, 1 by default
+//	PASSWORD_BCRYPT_COST     Cost, 12 by default
+//
+// The argon2id defaults follow the OWASP recommendation. main refuses to
+// start with parameters out of range, see LoadPasswordHashers.
+
+// PasswordHasher hashes passwords in a self-describing format.
+type PasswordHasher interface {
+	// Hash hashes a password with the current parameters.
+	Hash(password string) (string, error)
+	// Recognizes reports whether hash was made by this kind of hasher.
+	Recognizes(hash string) bool
+	// Verify reports whether password matches a hash this hasher recognizes.
+	Verify(password, hash string) (bool, error)
+	// NeedsRehash reports whether hash was made with other parameters than
+	// the current ones.
+	NeedsRehash(hash string) bool
+}
+
+// BcryptHasher hashes passwords with bcrypt, in its standard $2a$ format.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
 	return string(hashedPassword), err
 }
 
+func (h BcryptHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h BcryptHasher) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher hashes passwords with argon2id, in the PHC string format
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>.
+type Argon2idHasher struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen int
+	KeyLen  uint32
+}
+
+var b64 = base64.RawStdEncoding
+
+// validate checks the parameters argon2.IDKey would panic on, or that don't
+// fit the fields.
+func (h Argon2idHasher) validate() error {
+	switch {
+	case h.Memory < 8*uint32(h.Threads):
+		return fmt.Errorf("argon2id memory must be at least 8 KiB per thread, got %d KiB", h.Memory)
+	case h.Time < 1:
+		return errors.New("argon2id time must be at least 1")
+	case h.Threads < 1:
+		return errors.New("argon2id threads must be between 1 and 255")
+	}
+	return nil
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h Argon2idHasher) Verify(password, hash string) (bool, error) {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := parseArgon2id(hash)
+	return err != nil ||
+		params.Memory != h.Memory || params.Time != h.Time || params.Threads != h.Threads ||
+		len(salt) != h.SaltLen || uint32(len(key)) != h.KeyLen
+}
+
+func parseArgon2id(hash string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, errors.New("malformed argon2id parameters")
+	}
+	if err := params.validate(); err != nil {
+		return params, nil, nil, err
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errors.New("malformed argon2id salt")
+	}
+	key, err := b64.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("malformed argon2id key")
+	}
+	params.SaltLen, params.KeyLen = len(salt), uint32(len(key))
+	return params, salt, key, nil
+}
+
+// Hashers passwords are checked with, and the one new hashes are made with.
+// They have the default parameters until LoadPasswordHashers.
+var (
+	passwordHashers = []PasswordHasher{
+		Argon2idHasher{Memory: 19456, Time: 2, Threads: 1, SaltLen: 16, KeyLen: 32},
+		BcryptHasher{Cost: 12},
+	}
+	defaultPasswordHasher = passwordHashers[0]
+)
+
+// LoadPasswordHashers reads the hasher parameters from the configuration,
+// and refuses values that would make hashing fail or panic.
+func LoadPasswordHashers() error {
+	memory := config.Int("PASSWORD_ARGON2_MEMORY", 19456)
+	iterations := config.Int("PASSWORD_ARGON2_TIME", 2)
+	threads := config.Int("PASSWORD_ARGON2_THREADS", 1)
+	cost := config.Int("PASSWORD_BCRYPT_COST", 12)
+
+	switch {
+	case memory < 1 || memory > math.MaxUint32:
+		return fmt.Errorf("PASSWORD_ARGON2_MEMORY must be between 1 and %d, got %d", uint32(math.MaxUint32), memory)
+	case iterations < 1 || iterations > math.MaxUint32:
+		return fmt.Errorf("PASSWORD_ARGON2_TIME must be between 1 and %d, got %d", uint32(math.MaxUint32), iterations)
+	case threads < 1 || threads > math.MaxUint8:
+		return fmt.Errorf("PASSWORD_ARGON2_THREADS must be between 1 and %d, got %d", math.MaxUint8, threads)
+	case cost < bcrypt.MinCost || cost > bcrypt.MaxCost:
+		return fmt.Errorf("PASSWORD_BCRYPT_COST must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cost)
+	}
+
+	argon2id := Argon2idHasher{Memory: uint32(memory), Time: uint32(iterations), Threads: uint8(threads), SaltLen: 16, KeyLen: 32}
+	if err := argon2id.validate(); err != nil {
+		return fmt.Errorf("PASSWORD_ARGON2_MEMORY: %w", err)
+	}
+
+	passwordHashers = []PasswordHasher{argon2id, BcryptHasher{Cost: cost}}
+	defaultPasswordHasher = selectPasswordHasher(config.String("PASSWORD_HASHER", "argon2id"))
+	return nil
+}
+
+func selectPasswordHasher(name string) PasswordHasher {
+	switch name {
+	case "bcrypt":
+		return passwordHashers[1]
+	case "argon2id":
+	default:
+		log.Printf("Unknown PASSWORD_HASHER %q, using argon2id", name)
+	}
+	return passwordHashers[0]
+}
+
+// HashPassword hashes a password with the default hasher.
+func HashPassword(password string) (string, error) {
+	return defaultPasswordHasher.Hash(password)
+}
+
+// CheckPassword reports whether password matches hashedPassword, whichever
+// hasher made it.
 func CheckPassword(password, hashedPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+	for _, hasher := range passwordHashers {
+		if hasher.Recognizes(hashedPassword) {
+			ok, err := hasher.Verify(password, hashedPassword)
+			if err != nil {
+				log.Println("Failed to verify password hash:", err)
+			}
+			return ok
+		}
+	}
+	return false
+}
+
+// PasswordNeedsRehash reports whether hashedPassword was made by another
+// hasher than the default, or with outdated parameters.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	return !defaultPasswordHasher.Recognizes(hashedPassword) || defaultPasswordHasher.NeedsRehash(hashedPassword)
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// DummyPasswordHash returns a hash made by the default hasher to check
+// passwords against when there is no account, so both cases take as long.
+func DummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		password := make([]byte, 16)
+		rand.Read(password)
+		var err error
+		if dummyHash, err = HashPassword(string(password)); err != nil {
+			log.Println("Failed to make dummy password hash:", err)
+		}
+	})
+	return dummyHash
 }
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters, so the tests don't take seconds
+var (
+	testArgon2id = Argon2idHasher{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+	testBcrypt   = BcryptHasher{Cost: bcrypt.MinCost}
+)
+
+// useHashers makes hashers the known ones and the first the default.
+func useHashers(t *testing.T, hashers ...PasswordHasher) {
+	t.Helper()
+	savedHashers, savedDefault := passwordHashers, defaultPasswordHasher
+	t.Cleanup(func() { passwordHashers, defaultPasswordHasher = savedHashers, savedDefault })
+	passwordHashers, defaultPasswordHasher = hashers, hashers[0]
+}
+
+func TestPasswordHashers(t *testing.T) {
+	for _, hasher := range []PasswordHasher{testArgon2id, testBcrypt} {
+		hash, err := hasher.Hash("Correct7Horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasher.Recognizes(hash) {
+			t.Errorf("%T doesn't recognize its own hash %s", hasher, hash)
+		}
+		if ok, err := hasher.Verify("Correct7Horse", hash); !ok || err != nil {
+			t.Errorf("%T.Verify(right password) = %v, %v", hasher, ok, err)
+		}
+		if ok, _ := hasher.Verify("correct7horse", hash); ok {
+			t.Errorf("%T.Verify(wrong password) succeeded", hasher)
+		}
+		if again, _ := hasher.Hash("Correct7Horse"); again == hash {
+			t.Errorf("%T made the same hash twice, the salt isn't random", hasher)
+		}
+		if hasher.NeedsRehash(hash) {
+			t.Errorf("%T wants to rehash a hash with current parameters", hasher)
+		}
+	}
+}
+
+func TestArgon2idFormat(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("Correct7Horse"), salt, 1, 64, 1, 32)
+	hash := fmt.Sprintf("$argon2id$v=19$m=64,t=1,p=1$%s$%s", b64.EncodeToString(salt), b64.EncodeToString(key))
+
+	if ok, err := testArgon2id.Verify("Correct7Horse", hash); !ok || err != nil {
+		t.Errorf("Verify(PHC string) = %v, %v", ok, err)
+	}
+
+	malformed := []string{
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+		"$argon2id$v=19$m=64,t=1,p=1",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=0$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=256$c2FsdA$a2V5",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=8,t=1,p=2$c2FsdA$a2V5",
+	}
+	for _, hash := range malformed {
+		if _, err := testArgon2id.Verify("Correct7Horse", hash); err == nil {
+			t.Errorf("Verify(%q) accepted a malformed hash", hash)
+		}
+		if !testArgon2id.NeedsRehash(hash) {
+			t.Errorf("NeedsRehash(%q) = false for a malformed hash", hash)
+		}
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	argon2idHash, _ := testArgon2id.Hash("Correct7Horse")
+	bcryptHash, _ := testBcrypt.Hash("Correct7Horse")
+	strongerArgon2id := testArgon2id
+	strongerArgon2id.Time = 2
+	longerArgon2id := testArgon2id
+	longerArgon2id.KeyLen = 64
+	strongerBcrypt := BcryptHasher{Cost: bcrypt.MinCost + 1}
+
+	tests := []struct {
+		name    string
+		hasher  PasswordHasher // Default hasher
+		hash    string
+		rehash  bool
+		checkOK bool // CheckPassword still accepts the hash
+	}{
+		{"argon2id, current", testArgon2id, argon2idHash, false, true},
+		{"argon2id, more iterations", strongerArgon2id, argon2idHash, true, true},
+		{"argon2id, longer key", longerArgon2id, argon2idHash, true, true},
+		{"bcrypt under argon2id", testArgon2id, bcryptHash, true, true},
+		{"bcrypt, current", testBcrypt, bcryptHash, false, true},
+		{"bcrypt, higher cost", strongerBcrypt, bcryptHash, true, true},
+		{"argon2id under bcrypt", testBcrypt, argon2idHash, true, true},
+		{"unknown format", testArgon2id, "$1$plainmd5", true, false},
+	}
+	for _, test := range tests {
+		var other PasswordHasher = testBcrypt
+		if _, ok := test.hasher.(BcryptHasher); ok {
+			other = testArgon2id
+		}
+		useHashers(t, test.hasher, other)
+
+		if got := PasswordNeedsRehash(test.hash); got != test.rehash {
+			t.Errorf("%s: PasswordNeedsRehash = %v, want %v", test.name, got, test.rehash)
+		}
+		if got := CheckPassword("Correct7Horse", test.hash); got != test.checkOK {
+			t.Errorf("%s: CheckPassword = %v, want %v", test.name, got, test.checkOK)
+		}
+	}
+}
+
+func TestHashPasswordUsesDefault(t *testing.T) {
+	useHashers(t, testBcrypt, testArgon2id)
+	hash, err := HashPassword("Correct7Horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$2a$") || PasswordNeedsRehash(hash) {
+		t.Errorf("HashPassword = %s, want a current bcrypt hash", hash)
+	}
+}
+
+func TestSelectPasswordHasher(t *testing.T) {
+	tests := map[string]string{"argon2id": "utils.Argon2idHasher", "bcrypt": "utils.BcryptHasher", "md5": "utils.Argon2idHasher"}
+	for name, want := range tests {
+		if got := fmt.Sprintf("%T", selectPasswordHasher(name)); got != want {
+			t.Errorf("selectPasswordHasher(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestLoadPasswordHashers(t *testing.T) {
+	useHashers(t, testArgon2id, testBcrypt)
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"defaults", nil, false},
+		{"cheap", map[string]string{"PASSWORD_ARGON2_MEMORY": "64", "PASSWORD_ARGON2_TIME": "1", "PASSWORD_ARGON2_THREADS": "4"}, false},
+		{"no memory", map[string]string{"PASSWORD_ARGON2_MEMORY": "0"}, true},
+		{"too little memory per thread", map[string]string{"PASSWORD_ARGON2_MEMORY": "16", "PASSWORD_ARGON2_THREADS": "4"}, true},
+		{"too much memory", map[string]string{"PASSWORD_ARGON2_MEMORY": "4294967296"}, true},
+		{"no iterations", map[string]string{"PASSWORD_ARGON2_TIME": "0"}, true},
+		{"negative iterations", map[string]string{"PASSWORD_ARGON2_TIME": "-1"}, true},
+		{"no threads", map[string]string{"PASSWORD_ARGON2_THREADS": "0"}, true},
+		{"threads wrap around", map[string]string{"PASSWORD_ARGON2_THREADS": "256"}, true},
+		{"bcrypt cost too low", map[string]string{"PASSWORD_BCRYPT_COST": "3"}, true},
+		{"bcrypt cost too high", map[string]string{"PASSWORD_BCRYPT_COST": "32"}, true},
+	}
+	for _, test := range tests {
+		for _, key := range []string{"PASSWORD_ARGON2_MEMORY", "PASSWORD_ARGON2_TIME", "PASSWORD_ARGON2_THREADS", "PASSWORD_BCRYPT_COST"} {
+			t.Setenv(key, test.env[key]) // Empty counts as unset
+		}
+		err := LoadPasswordHashers()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: LoadPasswordHashers error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// SearchTerms splits a full-text query into the words to highlight,
+// dropping negated terms and the quotes around phrases.
+func SearchTerms(query string) []string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		if strings.HasPrefix(word, "-") {
+			continue
+		}
+		word = strings.TrimFunc(word, isNotWordRune)
+		if word != "" {
+			terms = append(terms, strings.ToLower(word))
+		}
+	}
+	return terms
+}
+
+// Highlight HTML-escapes text and wraps every word in <mark> tags that has
+// the same stem as one of the terms, the way a $text search matches words,
+// so "parties" highlights "party" but "art" doesn't highlight "party". Long
+// texts are cut down to a snippet around the first match. It returns "" when
+// none of the terms occur.
+func Highlight(text string, terms []string, maxLength int) string {
+	stems := map[string]bool{}
+	for _, term := range terms {
+		for _, word := range strings.FieldsFunc(term, isNotWordRune) {
+			stems[Stem(word)] = true
+		}
+	}
+
+	// Mark the runes that belong to a matching word
+	runes := []rune(text)
+	marked := make([]bool, len(runes))
+	first := -1
+	for i := 0; i < len(runes); {
+		if isNotWordRune(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && !isNotWordRune(runes[j]) {
+			j++
+		}
+		if stems[Stem(string(runes[i:j]))] {
+			for k := i; k < j; k++ {
+				marked[k] = true
+			}
+			if first == -1 {
+				first = i
+			}
+		}
+		i = j
+	}
+	if first == -1 {
+		return ""
+	}
+
+	start, end := 0, len(runes)
+	if maxLength > 0 && len(runes) > maxLength {
+		start = first - maxLength/4
+		if start < 0 {
+			start = 0
+		}
+		end = start + maxLength
+		if end > len(runes) {
+			end = len(runes)
+			start = end - maxLength
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if marked[i] && (i == start || !marked[i-1]) {
+			b.WriteString("<mark>")
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		if marked[i] && (i == end-1 || !marked[i+1]) {
+			b.WriteString("</mark>")
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
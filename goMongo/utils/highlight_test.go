@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"Jazz Night", []string{"jazz", "night"}},
+		{`"open air" concert`, []string{"open", "air", "concert"}},
+		{"music -rock", []string{"music"}},
+		{"  ", nil},
+	}
+	for _, test := range tests {
+		if got := SearchTerms(test.query); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SearchTerms(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		terms     []string
+		maxLength int
+		want      string
+	}{
+		{"whole word", "Art in the park", []string{"art"}, 0, "<mark>Art</mark> in the park"},
+		{"not inside a word", "Birthday party", []string{"art"}, 0, ""},
+		{"same stem", "Two parties tonight", []string{"party"}, 0, "Two <mark>parties</mark> tonight"},
+		{"every match", "Run, running, runs", []string{"run"}, 0, "<mark>Run</mark>, <mark>running</mark>, <mark>runs</mark>"},
+		{"escapes html", "<b>Jazz</b> & blues", []string{"jazz"}, 0, "&lt;b&gt;<mark>Jazz</mark>&lt;/b&gt; &amp; blues"},
+		{"snippet", "one two three four five six seven eight nine ten", []string{"six"}, 12, "…ve <mark>six</mark> seven…"},
+		{"no terms", "Art in the park", nil, 0, ""},
+	}
+	for _, test := range tests {
+		if got := Highlight(test.text, test.terms, test.maxLength); got != test.want {
+			t.Errorf("%s: Highlight(%q, %q) = %q, want %q", test.name, test.text, test.terms, got, test.want)
+		}
+	}
+}
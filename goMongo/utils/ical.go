@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ICalEvent holds the fields rendered into a single VEVENT.
+type ICalEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time // optional
+	Status      string    // CONFIRMED, TENTATIVE or CANCELLED
+}
+
+// BuildICalendar renders events as an RFC 5545 VCALENDAR document.
+func BuildICalendar(name string, events []ICalEvent) string {
+	var b strings.Builder
+	stamp := formatICalTime(time.Now())
+
+	writeICalLine(&b, "BEGIN:VCALENDAR")
+	writeICalLine(&b, "VERSION:2.0")
+	writeICalLine(&b, "PRODID:-//goMongo//Events//EN")
+	writeICalLine(&b, "CALSCALE:GREGORIAN")
+	if name != "" {
+		writeICalLine(&b, "X-WR-CALNAME:"+escapeICalText(name))
+	}
+
+	for _, event := range events {
+		writeICalLine(&b, "BEGIN:VEVENT")
+		writeICalLine(&b, "UID:"+event.UID)
+		writeICalLine(&b, "DTSTAMP:"+stamp)
+		writeICalLine(&b, "DTSTART:"+formatICalTime(event.Start))
+		if !event.End.IsZero() {
+			writeICalLine(&b, "DTEND:"+formatICalTime(event.End))
+		}
+		writeICalLine(&b, "SUMMARY:"+escapeICalText(event.Summary))
+		if event.Description != "" {
+			writeICalLine(&b, "DESCRIPTION:"+escapeICalText(event.Description))
+		}
+		if event.Location != "" {
+			writeICalLine(&b, "LOCATION:"+escapeICalText(event.Location))
+		}
+		if event.Status != "" {
+			writeICalLine(&b, "STATUS:"+event.Status)
+		}
+		writeICalLine(&b, "END:VEVENT")
+	}
+
+	writeICalLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// GenerateCalendarToken signs a user ID into a token that calendar apps can
+// put in a subscription URL, since they can't send an Authorization header.
+// The signature covers the user's random feed key as well, so replacing the
+// key revokes every token made with it.
+func GenerateCalendarToken(userId primitive.ObjectID, feedKey string) string {
+	return userId.Hex() + "." + signCalendar(userId.Hex()+"."+feedKey)
+}
+
+// CalendarTokenUser returns the user ID a calendar token was made for. It
+// doesn't check the signature, VerifyCalendarToken does once the user's
+// feed key is known.
+func CalendarTokenUser(token string) (primitive.ObjectID, error) {
+	userIdHex, _, found := strings.Cut(token, ".")
+	if !found {
+		return primitive.NilObjectID, errors.New("malformed calendar token")
+	}
+	userId, err := primitive.ObjectIDFromHex(userIdHex)
+	if err != nil {
+		return primitive.NilObjectID, errors.New("invalid user ID in calendar token")
+	}
+	return userId, nil
+}
+
+// VerifyCalendarToken reports whether token was made for the user with
+// their current feed key. Users without a feed key have no valid tokens.
+func VerifyCalendarToken(token string, userId primitive.ObjectID, feedKey string) bool {
+	if feedKey == "" {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(GenerateCalendarToken(userId, feedKey)))
+}
+
+func signCalendar(payload string) string {
+	if len(calendarSecret) == 0 {
+		panic("utils: CALENDAR_SECRET wasn't loaded, see LoadSecrets")
+	}
+	mac := hmac.New(sha256.New, calendarSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func formatICalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeICalText escapes a TEXT value as described in RFC 5545 section 3.3.11.
+func escapeICalText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// writeICalLine writes a content line, folding it at 75 octets without
+// splitting a multi-byte character, and terminates it with CRLF.
+func writeICalLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func isRuneStart(c byte) bool {
+	return c&0xC0 != 0x80
+}
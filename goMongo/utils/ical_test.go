@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEscapeICalText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"plain", "plain"},
+		{"a,b;c", `a\,b\;c`},
+		{`back\slash`, `back\\slash`},
+		{"two\nlines", `two\nlines`},
+		{"crlf\r\nline", `crlf\nline`},
+		{`\,`, `\\\,`},
+	}
+	for _, test := range tests {
+		if got := escapeICalText(test.text); got != test.want {
+			t.Errorf("escapeICalText(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestWriteICalLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"short", "SUMMARY:Party"},
+		{"exactly 75 octets", "SUMMARY:" + strings.Repeat("x", 67)},
+		{"76 octets", "SUMMARY:" + strings.Repeat("x", 68)},
+		{"several folds", "DESCRIPTION:" + strings.Repeat("abcdefghij", 30)},
+		{"multi-byte at the fold", "SUMMARY:" + strings.Repeat("x", 66) + strings.Repeat("é", 40)},
+		{"only multi-byte", "SUMMARY:" + strings.Repeat("日本", 50)},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		writeICalLine(&b, test.line)
+		out := b.String()
+
+		if !strings.HasSuffix(out, "\r\n") {
+			t.Errorf("%s: line isn't terminated with CRLF: %q", test.name, out)
+			continue
+		}
+		physical := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+		for i, p := range physical {
+			if len(p) > 75 {
+				t.Errorf("%s: physical line %d is %d octets long", test.name, i, len(p))
+			}
+			if i > 0 && !strings.HasPrefix(p, " ") {
+				t.Errorf("%s: continuation line %d doesn't start with a space", test.name, i)
+			}
+			if !utf8.ValidString(p) {
+				t.Errorf("%s: physical line %d splits a character", test.name, i)
+			}
+		}
+
+		// Unfolding gives back the original line
+		if unfolded := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); unfolded != test.line {
+			t.Errorf("%s: unfolded line = %q, want %q", test.name, unfolded, test.line)
+		}
+	}
+}
+
+func TestBuildICalendar(t *testing.T) {
+	start := time.Date(2024, 7, 1, 18, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	out := BuildICalendar("My events", []ICalEvent{{
+		UID:     "1@goMongo",
+		Summary: "Meetup, Amsterdam",
+		Start:   start,
+		End:     start.Add(time.Hour),
+		Status:  "CONFIRMED",
+	}})
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:My events\r\n",
+		"DTSTART:20240701T163000Z\r\n",
+		"DTEND:20240701T173000Z\r\n",
+		`SUMMARY:Meetup\, Amsterdam` + "\r\n",
+		"STATUS:CONFIRMED\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("calendar doesn't contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "LOCATION:") {
+		t.Error("calendar has a LOCATION for an event without one")
+	}
+}
+
+func TestCalendarToken(t *testing.T) {
+	calendarSecret = []byte("0123456789abcdef0123456789abcdef")
+
+	userId := primitive.NewObjectID()
+	token := GenerateCalendarToken(userId, "feedkey")
+
+	if got, err := CalendarTokenUser(token); err != nil || got != userId {
+		t.Errorf("CalendarTokenUser = %s, %v, want %s", got.Hex(), err, userId.Hex())
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		userId  primitive.ObjectID
+		feedKey string
+		want    bool
+	}{
+		{"valid", token, userId, "feedkey", true},
+		{"rotated feed key", token, userId, "newfeedkey", false},
+		{"revoked feed key", token, userId, "", false},
+		{"other user", token, primitive.NewObjectID(), "feedkey", false},
+		{"tampered signature", token + "x", userId, "feedkey", false},
+		{"empty", "", userId, "feedkey", false},
+	}
+	for _, test := range tests {
+		if got := VerifyCalendarToken(test.token, test.userId, test.feedKey); got != test.want {
+			t.Errorf("%s: VerifyCalendarToken = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	for _, token := range []string{"", "nodot", "nothex.signature"} {
+		if _, err := CalendarTokenUser(token); err == nil {
+			t.Errorf("CalendarTokenUser(%q) succeeded, want an error", token)
+		}
+	}
+}
@@ -1,24 +1,96 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
 
+	"example.com/goMongo/config"
 	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-const secretKey = "secretkey"
+// Values put into and required from every token
+var (
+	tokenIssuer   = config.String("JWT_ISSUER", "go-mongo-events")
+	tokenAudience = config.String("JWT_AUDIENCE", "go-mongo-events")
+	tokenTTL      = config.Duration("JWT_TTL", 2*time.Hour)
+	tokenLeeway   = config.Duration("JWT_LEEWAY", 30*time.Second) // Allowed clock skew between servers
+)
+
+// Token purposes. Access tokens have none.
+const mfaPurpose = "mfa"
+
+// Claims are the claims of the tokens we issue. The user is the subject.
+type Claims struct {
+	Email     string `json:"email,omitempty"`
+	UserID    string `json:"userId,omitempty"`  // Same as the subject, kept for clients that read it
+	Purpose   string `json:"purpose,omitempty"` // Set on tokens that don't grant access by themselves
+	SessionID string `json:"sid,omitempty"`     // Session the token was issued for, see models.Session
+	jwt.RegisteredClaims
+}
+
+// newClaims fills in the registered claims for a token about userId.
+func newClaims(userId primitive.ObjectID, ttl time.Duration) (Claims, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return Claims{}, err
+	}
+
+	now := time.Now()
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userId.Hex(),
+			Issuer:    tokenIssuer,
+			Audience:  jwt.ClaimStrings{tokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        hex.EncodeToString(jti),
+		},
+	}, nil
+}
+
+// ParseToken verifies a token's signature and registered claims and returns
+// its claims.
+func ParseToken(token string) (*Claims, error) {
+	var claims Claims
+	parsedToken, err := jwt.ParseWithClaims(token, &claims, verificationKey,
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithAudience(tokenAudience),
+		jwt.WithLeeway(tokenLeeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, errors.New("could not parse token")
+	}
+
+	// Check if the token is valid
+	if !parsedToken.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return &claims, nil
+}
 
-func GenerateToken(email string, userId primitive.ObjectID) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email":  email,
-		"userId": userId.Hex(), // Store ObjectID as a string
-		"exp":    time.Now().Add(time.Hour * 2).Unix(),
-	})
+// AccessTokenTTL is how long the tokens from GenerateToken are valid.
+func AccessTokenTTL() time.Duration {
+	return tokenTTL
+}
+
+func GenerateToken(email string, userId primitive.ObjectID, sessionId string) (string, error) {
+	claims, err := newClaims(userId, tokenTTL)
+	if err != nil {
+		return "", err
+	}
+	claims.Email = email
+	claims.UserID = userId.Hex() // Store ObjectID as a string
+	claims.SessionID = sessionId
 
 	// Sign and get the complete encoded token as a string
-	tokenString, err := token.SignedString([]byte(secretKey))
+	tokenString, err := signToken(claims)
 	if err != nil {
 		return "", err
 	}
@@ -26,42 +98,52 @@ func GenerateToken(email string, userId primitive.ObjectID) (string, error) {
 	return tokenString, nil
 }
 
-func VerifyToken(token string) (primitive.ObjectID, error) {
-	// Parse the JWT token
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		// Check if the signing method is HMAC
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		// Return the secret key for validation
-		return []byte(secretKey), nil
-	})
+// VerifyToken checks an access token and returns the user and the session
+// it was issued for. Whether the session is still active is up to the
+// caller.
+func VerifyToken(token string) (primitive.ObjectID, string, error) {
+	claims, err := ParseToken(token)
 	if err != nil {
-		return primitive.NilObjectID, errors.New("could not parse token")
+		return primitive.NilObjectID, "", err
 	}
 
-	// Check if the token is valid
-	if !parsedToken.Valid {
-		return primitive.NilObjectID, errors.New("invalid token")
+	// Tokens with a purpose only get access through their own endpoint
+	if claims.Purpose != "" {
+		return primitive.NilObjectID, "", errors.New("invalid token")
 	}
 
-	// Extract claims from the token
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-	if !ok {
-		return primitive.NilObjectID, errors.New("invalid token claims")
+	// Convert user ID string to ObjectID
+	userId, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return primitive.NilObjectID, "", errors.New("invalid user ID format")
 	}
 
-	// Extract the user ID from claims
-	userIdHex, ok := claims["userId"].(string)
-	if !ok {
-		return primitive.NilObjectID, errors.New("invalid user ID in token claims")
+	return userId, claims.SessionID, nil
+}
+
+// GenerateMFAToken issues the short-lived token a user gets after passing
+// the password step of a login with MFA enabled. It only proves the
+// password was right, so VerifyToken rejects it.
+func GenerateMFAToken(userId primitive.ObjectID) (string, error) {
+	claims, err := newClaims(userId, 5*time.Minute)
+	if err != nil {
+		return "", err
 	}
+	claims.Purpose = mfaPurpose
+	return signToken(claims)
+}
 
-	// Convert user ID string to ObjectID
-	userId, err := primitive.ObjectIDFromHex(userIdHex)
+// VerifyMFAToken checks a token from GenerateMFAToken and returns the user
+// it was issued for.
+func VerifyMFAToken(token string) (primitive.ObjectID, error) {
+	claims, err := ParseToken(token)
+	if err != nil || claims.Purpose != mfaPurpose {
+		return primitive.NilObjectID, errors.New("invalid MFA token")
+	}
+
+	userId, err := primitive.ObjectIDFromHex(claims.Subject)
 	if err != nil {
-		return primitive.NilObjectID, errors.New("invalid user ID format")
+		return primitive.NilObjectID, errors.New("invalid MFA token")
 	}
 
 	return userId, nil
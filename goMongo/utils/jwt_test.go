@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func useSharedSecret(t *testing.T) {
+	t.Helper()
+	useKeys(t, map[string]string{"JWT_ALGORITHM": "HS256", "JWT_SECRET": "0123456789abcdef0123456789abcdef"})
+}
+
+func TestGenerateTokenClaims(t *testing.T) {
+	useSharedSecret(t)
+	userId := primitive.NewObjectID()
+
+	token, err := GenerateToken("ada@example.com", userId, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != userId.Hex() || claims.UserID != userId.Hex() {
+		t.Errorf("subject = %q, userId = %q, want %s", claims.Subject, claims.UserID, userId.Hex())
+	}
+	if claims.Email != "ada@example.com" || claims.SessionID != "session" || claims.Purpose != "" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if claims.Issuer != tokenIssuer || len(claims.Audience) != 1 || claims.Audience[0] != tokenAudience {
+		t.Errorf("issuer = %q, audience = %q", claims.Issuer, claims.Audience)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != tokenTTL {
+		t.Errorf("token lives %v, want %v", lifetime, tokenTTL)
+	}
+	if claims.ID == "" {
+		t.Error("token has no ID")
+	}
+	if other, _ := GenerateToken("ada@example.com", userId, "session"); other == token {
+		t.Error("two tokens are identical, the token ID isn't random")
+	}
+
+	gotUser, gotSession, err := VerifyToken(token)
+	if err != nil || gotUser != userId || gotSession != "session" {
+		t.Errorf("VerifyToken = %s, %q, %v", gotUser.Hex(), gotSession, err)
+	}
+}
+
+func TestParseTokenRegisteredClaims(t *testing.T) {
+	useSharedSecret(t)
+	userId := primitive.NewObjectID()
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		modify func(*Claims)
+		ok     bool
+	}{
+		{"valid", func(*Claims) {}, true},
+		{"expired within the leeway", func(c *Claims) {
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(-tokenLeeway / 2))
+		}, true},
+		{"expired beyond the leeway", func(c *Claims) {
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(-2 * tokenLeeway))
+		}, false},
+		{"not yet valid within the leeway", func(c *Claims) {
+			c.NotBefore = jwt.NewNumericDate(now.Add(tokenLeeway / 2))
+		}, true},
+		{"not yet valid beyond the leeway", func(c *Claims) {
+			c.NotBefore = jwt.NewNumericDate(now.Add(2 * tokenLeeway))
+		}, false},
+		{"issued in the future", func(c *Claims) {
+			c.IssuedAt = jwt.NewNumericDate(now.Add(2 * tokenLeeway))
+		}, false},
+		{"no expiry", func(c *Claims) { c.ExpiresAt = nil }, false},
+		{"other issuer", func(c *Claims) { c.Issuer = "someone-else" }, false},
+		{"other audience", func(c *Claims) { c.Audience = jwt.ClaimStrings{"someone-else"} }, false},
+	}
+	for _, test := range tests {
+		claims, err := newClaims(userId, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.modify(&claims)
+		token, err := signToken(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseToken(token); (err == nil) != test.ok {
+			t.Errorf("%s: ParseToken error = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+
+	if _, err := ParseToken("not.a.token"); err == nil {
+		t.Error("ParseToken accepted garbage")
+	}
+}
+
+func TestMFATokenPurpose(t *testing.T) {
+	useSharedSecret(t)
+	userId := primitive.NewObjectID()
+
+	mfaToken, err := GenerateMFAToken(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, err := GenerateToken("ada@example.com", userId, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := VerifyMFAToken(mfaToken); err != nil || got != userId {
+		t.Errorf("VerifyMFAToken(MFA token) = %s, %v", got.Hex(), err)
+	}
+	if _, _, err := VerifyToken(mfaToken); err == nil {
+		t.Error("an MFA token granted access")
+	}
+	if _, err := VerifyMFAToken(accessToken); err == nil {
+		t.Error("an access token passed as an MFA token")
+	}
+}
@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"example.com/goMongo/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Tokens are signed according to JWT_ALGORITHM:
+//
+//   - HS256 (default) signs with the shared secret JWT_SECRET. It has no
+//     default, like the secrets in secrets.go, and must be at least
+//     minSecretLength characters long.
+//   - RS256 and EdDSA sign with a private key from JWT_KEYS_DIR. Every
+//     <kid>.pem file in it is a key, named by its key ID. Files holding a
+//     private key can sign, files holding only a public key still verify.
+//     JWT_SIGNING_KEY_ID picks the signing key, and defaults to the last
+//     private key of the configured algorithm by name.
+//
+// Public keys are published at /.well-known/jwks.json. To rotate keys:
+//
+//  1. Add the new private key to JWT_KEYS_DIR and reload. It is published,
+//     but tokens are still signed with the old key.
+//  2. Once services verifying our tokens refreshed their copy of the JWKS,
+//     point JWT_SIGNING_KEY_ID at the new key (or rely on the default) and
+//     reload.
+//  3. Replace the old private key with its public key, and delete it once
+//     the last token it signed has expired.
+//
+// Keys are reloaded with LoadSigningKeys, which main calls on SIGHUP.
+
+// signingKey is a key tokens are signed or verified with.
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{} // Nil for keys that only verify
+	Public  interface{}
+}
+
+type keySet struct {
+	signing *signingKey
+	byID    map[string]*signingKey
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   *keySet
+)
+
+// LoadSigningKeys (re)loads the keys tokens are signed and verified with
+// from the configuration. The previous keys stay in use when it fails.
+func LoadSigningKeys() error {
+	var set *keySet
+	var err error
+	switch algorithm := config.String("JWT_ALGORITHM", "HS256"); algorithm {
+	case "HS256":
+		secret, err := requiredSecret("JWT_SECRET")
+		if err != nil {
+			return err
+		}
+		key := &signingKey{ID: config.String("JWT_KEY_ID", "hs256"), Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+		set = &keySet{signing: key, byID: map[string]*signingKey{key.ID: key}}
+	case "RS256", "EdDSA":
+		set, err = loadKeyDir(config.String("JWT_KEYS_DIR", "keys"), algorithm, config.String("JWT_SIGNING_KEY_ID", ""))
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %q, expected HS256, RS256 or EdDSA", algorithm)
+	}
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keys = set
+	return nil
+}
+
+func loadKeyDir(dir, algorithm, signingKeyId string) (*keySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	set := &keySet{byID: map[string]*signingKey{}}
+	for _, path := range paths {
+		key, err := parseKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		set.byID[key.ID] = key
+
+		if key.Private != nil && key.Method.Alg() == algorithm && (signingKeyId == "" || signingKeyId == key.ID) {
+			set.signing = key
+		}
+	}
+
+	if set.signing == nil {
+		return nil, fmt.Errorf("no %s private key to sign with in %s", algorithm, dir)
+	}
+	return set, nil
+}
+
+func parseKeyFile(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{ID: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return key, nil
+}
+
+func currentKeys() (*keySet, error) {
+	keysMu.RLock()
+	set := keys
+	keysMu.RUnlock()
+	if set != nil {
+		return set, nil
+	}
+
+	if err := LoadSigningKeys(); err != nil {
+		return nil, err
+	}
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return keys, nil
+}
+
+// signToken signs claims with the current signing key and names the key in
+// the kid header.
+func signToken(claims jwt.Claims) (string, error) {
+	set, err := currentKeys()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(set.signing.Method, claims)
+	token.Header["kid"] = set.signing.ID
+	return token.SignedString(set.signing.Private)
+}
+
+// verificationKey finds the key a token was signed with, by its kid header.
+// Tokens without one were issued before key IDs existed, and are only
+// accepted while signing with the shared secret.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	set, err := currentKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	key := set.signing
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = set.byID[kid]; !ok {
+			return nil, errors.New("unknown signing key")
+		}
+	} else if set.signing.Method != jwt.SigningMethodHS256 {
+		return nil, errors.New("missing key ID")
+	}
+
+	// The algorithm comes from the key, never from the token alone
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public keys tokens can be verified with as a JSON Web
+// Key Set. Shared secrets are never published, so it is empty for HS256.
+func JWKS() (map[string]interface{}, error) {
+	set, err := currentKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(set.byID))
+	for id := range set.byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := []map[string]string{}
+	for _, id := range ids {
+		key := set.byID[id]
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "RSA",
+				"kid": key.ID,
+				"alg": key.Method.Alg(),
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"kid": key.ID,
+				"alg": key.Method.Alg(),
+				"use": "sig",
+				"x":   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	return map[string]interface{}{"keys": jwks}, nil
+}
@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// useKeys loads the signing keys from a configuration for one test.
+func useKeys(t *testing.T, env map[string]string) {
+	t.Helper()
+	saved := keys
+	t.Cleanup(func() { keys = saved })
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	if err := LoadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeKey(t *testing.T, dir, kid string, key interface{}) {
+	t.Helper()
+	var block *pem.Block
+	switch k := key.(type) {
+	case ed25519.PublicKey, *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+	userId := primitive.NewObjectID()
+	env := map[string]string{"JWT_ALGORITHM": "EdDSA", "JWT_KEYS_DIR": dir}
+
+	// Only the old key
+	writeKey(t, dir, "2024-01", oldKey)
+	useKeys(t, env)
+	oldToken, err := GenerateToken("ada@example.com", userId, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKeyID(t, oldToken); kid != "2024-01" {
+		t.Fatalf("signed with kid %q, want 2024-01", kid)
+	}
+
+	// 1. The new key is published but the old one still signs
+	writeKey(t, dir, "2024-07", newKey)
+	env["JWT_SIGNING_KEY_ID"] = "2024-01"
+	useKeys(t, env)
+	jwks, err := JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published := jwks["keys"].([]map[string]string); len(published) != 2 || published[0]["kid"] != "2024-01" || published[1]["kid"] != "2024-07" {
+		t.Errorf("JWKS = %v, want both keys", published)
+	}
+	if token, _ := GenerateToken("ada@example.com", userId, ""); tokenKeyID(t, token) != "2024-01" {
+		t.Error("signed with the new key before switching to it")
+	}
+
+	// 2. Switching to the new key, by default the last one by name
+	env["JWT_SIGNING_KEY_ID"] = ""
+	useKeys(t, env)
+	newToken, err := GenerateToken("ada@example.com", userId, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKeyID(t, newToken); kid != "2024-07" {
+		t.Errorf("signed with kid %q after rotating, want 2024-07", kid)
+	}
+
+	// 3. The old key only verifies once its private key is gone
+	writeKey(t, dir, "2024-01", oldKey.Public())
+	useKeys(t, env)
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if got, _, err := VerifyToken(token); err != nil || got != userId {
+			t.Errorf("VerifyToken(%s token) = %s, %v", name, got.Hex(), err)
+		}
+	}
+
+	// Tokens of a deleted key stop working
+	os.Remove(filepath.Join(dir, "2024-01.pem"))
+	useKeys(t, env)
+	if _, _, err := VerifyToken(oldToken); err == nil {
+		t.Error("accepted a token signed with a removed key")
+	}
+}
+
+func TestLoadKeyDir(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "ed", edKey)
+	writeKey(t, dir, "rsa", rsaKey)
+	writeKey(t, dir, "rsa-public", &rsaKey.PublicKey)
+
+	tests := []struct {
+		algorithm string
+		kid       string
+		want      string // Empty when loading fails
+	}{
+		{"EdDSA", "", "ed"},
+		{"RS256", "", "rsa"},
+		{"RS256", "rsa", "rsa"},
+		{"RS256", "ed", ""},         // Not an RS256 key
+		{"RS256", "rsa-public", ""}, // Can't sign
+		{"EdDSA", "missing", ""},
+	}
+	for _, test := range tests {
+		set, err := loadKeyDir(dir, test.algorithm, test.kid)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("loadKeyDir(%s, %q) signs with %s, want an error", test.algorithm, test.kid, set.signing.ID)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("loadKeyDir(%s, %q) failed: %v", test.algorithm, test.kid, err)
+			continue
+		}
+		if set.signing.ID != test.want || len(set.byID) != 3 {
+			t.Errorf("loadKeyDir(%s, %q) signs with %s of %d keys, want %s of 3", test.algorithm, test.kid, set.signing.ID, len(set.byID), test.want)
+		}
+	}
+
+	if _, err := loadKeyDir(t.TempDir(), "EdDSA", ""); err == nil {
+		t.Error("loadKeyDir accepted a directory without keys")
+	}
+	os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0o600)
+	if _, err := loadKeyDir(dir, "EdDSA", ""); err == nil {
+		t.Error("loadKeyDir accepted a file that isn't a key")
+	}
+}
+
+func TestVerificationKeyChecksAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	writeKey(t, dir, "ed", private)
+	useKeys(t, map[string]string{"JWT_ALGORITHM": "EdDSA", "JWT_KEYS_DIR": dir})
+
+	claims, err := newClaims(primitive.NewObjectID(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"matching key", sign(jwt.SigningMethodEdDSA, "ed", private), true},
+		{"public key as an HMAC secret", sign(jwt.SigningMethodHS256, "ed", []byte(public)), false},
+		{"no key ID", sign(jwt.SigningMethodEdDSA, "", private), false},
+		{"unknown key ID", sign(jwt.SigningMethodEdDSA, "other", private), false},
+	}
+	for _, test := range tests {
+		if _, err := ParseToken(test.token); (err == nil) != test.ok {
+			t.Errorf("%s: ParseToken error = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestSharedSecretRequired(t *testing.T) {
+	saved := keys
+	t.Cleanup(func() { keys = saved })
+	t.Setenv("JWT_ALGORITHM", "HS256")
+
+	tests := []struct {
+		secret  string
+		wantErr bool
+	}{
+		{"", true},
+		{"secretkey", true},
+		{"0123456789abcdef0123456789abcdef", false},
+	}
+	for _, test := range tests {
+		t.Setenv("JWT_SECRET", test.secret)
+		err := LoadSigningKeys()
+		if (err != nil) != test.wantErr {
+			t.Errorf("LoadSigningKeys with JWT_SECRET %q: error = %v, want error %v", test.secret, err, test.wantErr)
+		}
+	}
+}
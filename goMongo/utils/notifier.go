@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Notification is a message to a single user.
+type Notification struct {
+	UserID  string // Hex ID of the user, logged instead of the address
+	Email   string
+	Name    string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers notifications, e.g. by email or push. Deployments plug
+// in their own implementation with SetNotifier.
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// LogNotifier prints notifications instead of delivering them. It is the
+// default until a real notifier is configured, and only logs the user ID so
+// logs don't collect email addresses.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(notification Notification) error {
+	fmt.Printf("Notification to user %s: %s\n", notification.UserID, notification.Subject)
+	return nil
+}
+
+var (
+	notifierMu sync.RWMutex
+	notifier   Notifier = LogNotifier{}
+)
+
+// SetNotifier replaces the notifier used by Notify.
+func SetNotifier(n Notifier) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	notifier = n
+}
+
+// Notify sends a notification through the configured notifier.
+func Notify(notification Notification) error {
+	notifierMu.RLock()
+	defer notifierMu.RUnlock()
+	return notifier.Notify(notification)
+}
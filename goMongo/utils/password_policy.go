@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"example.com/goMongo/config"
+)
+
+// Password policy, applied wherever a password is set:
+//
+//	PASSWORD_MIN_LENGTH        Minimum length in characters, 10 by default
+//	PASSWORD_REQUIRED_CLASSES  Character classes every password needs, out of
+//	                           lower, upper, digit and symbol. "lower,upper,digit"
+//	                           by default, empty for none
+//	PASSWORD_DENYLIST_FILE     File of common passwords that are refused, one
+//	                           per line, instead of the built-in
+//	                           common-passwords.txt. main refuses to start when
+//	                           it can't be loaded, see LoadPasswordDenyList
+//
+// Passwords can't contain the email address or its local part either.
+var (
+	passwordMinLength       = config.Int("PASSWORD_MIN_LENGTH", 10)
+	passwordRequiredClasses = config.List("PASSWORD_REQUIRED_CLASSES", []string{"lower", "upper", "digit"})
+	passwordDenyListFile    = config.String("PASSWORD_DENYLIST_FILE", "")
+)
+
+//go:embed common-passwords.txt
+var builtinDenyList string
+
+// bcrypt ignores everything after 72 bytes
+const passwordMaxBytes = 72
+
+// Password policy rules
+const (
+	PasswordRuleMinLength = "minLength"
+	PasswordRuleMaxLength = "maxLength"
+	PasswordRuleLower     = "lower"
+	PasswordRuleUpper     = "upper"
+	PasswordRuleDigit     = "digit"
+	PasswordRuleSymbol    = "symbol"
+	PasswordRuleCommon    = "common"
+	PasswordRuleEmail     = "email"
+)
+
+// PasswordViolation is a rule of the password policy a password breaks.
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password breaks, so users can fix
+// them all at once.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return strings.Join(messages, " ")
+}
+
+var passwordClasses = map[string]struct {
+	matches func(rune) bool
+	message string
+}{
+	PasswordRuleLower:  {unicode.IsLower, "Password must contain a lowercase letter."},
+	PasswordRuleUpper:  {unicode.IsUpper, "Password must contain an uppercase letter."},
+	PasswordRuleDigit:  {unicode.IsDigit, "Password must contain a digit."},
+	PasswordRuleSymbol: {func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }, "Password must contain a symbol."},
+}
+
+// ValidatePassword checks a new password for the account with email against
+// the password policy, and returns a *PasswordPolicyError when it breaks
+// any rule.
+func ValidatePassword(password, email string) error {
+	var violations []PasswordViolation
+
+	if utf8.RuneCountInString(password) < passwordMinLength {
+		violations = append(violations, PasswordViolation{PasswordRuleMinLength, fmt.Sprintf("Password must be at least %d characters long.", passwordMinLength)})
+	}
+	if len(password) > passwordMaxBytes {
+		violations = append(violations, PasswordViolation{PasswordRuleMaxLength, fmt.Sprintf("Password must be at most %d bytes long.", passwordMaxBytes)})
+	}
+
+	for _, class := range passwordRequiredClasses {
+		rule, ok := passwordClasses[class]
+		if !ok {
+			continue
+		}
+		if strings.IndexFunc(password, rule.matches) < 0 {
+			violations = append(violations, PasswordViolation{class, rule.message})
+		}
+	}
+
+	if isCommonPassword(password) {
+		violations = append(violations, PasswordViolation{PasswordRuleCommon, "Password is too common."})
+	}
+
+	if containsEmail(password, email) {
+		violations = append(violations, PasswordViolation{PasswordRuleEmail, "Password must not contain your email address."})
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// containsEmail reports whether password contains the email address or its
+// local part. Local parts too short to matter are ignored.
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(password, local)
+}
+
+// Common passwords, lower case
+var denyList = parseDenyList(strings.NewReader(builtinDenyList))
+
+// LoadPasswordDenyList replaces the built-in deny list with
+// PASSWORD_DENYLIST_FILE when it is set. A list that can't be read is an
+// error rather than an empty list, which would accept every password.
+func LoadPasswordDenyList() error {
+	if passwordDenyListFile == "" {
+		return nil
+	}
+	file, err := os.Open(passwordDenyListFile)
+	if err != nil {
+		return fmt.Errorf("PASSWORD_DENYLIST_FILE: %w", err)
+	}
+	defer file.Close()
+
+	list := parseDenyList(file)
+	if list == nil {
+		return fmt.Errorf("PASSWORD_DENYLIST_FILE: %s can't be read", passwordDenyListFile)
+	}
+	if len(list) == 0 {
+		return fmt.Errorf("PASSWORD_DENYLIST_FILE: %s lists no passwords", passwordDenyListFile)
+	}
+	denyList = list
+	return nil
+}
+
+// parseDenyList reads one password per line, skipping blank lines and
+// comments. It returns nil when reading fails.
+func parseDenyList(r io.Reader) map[string]bool {
+	list := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			list[strings.ToLower(line)] = true
+		}
+	}
+	if scanner.Err() != nil {
+		return nil
+	}
+	return list
+}
+
+// isCommonPassword looks the password up in the deny list, ignoring case.
+func isCommonPassword(password string) bool {
+	return denyList[strings.ToLower(password)]
+}
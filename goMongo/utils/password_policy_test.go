@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	savedLength, savedClasses := passwordMinLength, passwordRequiredClasses
+	defer func() { passwordMinLength, passwordRequiredClasses = savedLength, savedClasses }()
+	passwordMinLength = 10
+	passwordRequiredClasses = []string{"lower", "upper", "digit"}
+	savedDenyList := denyList
+	defer func() { denyList = savedDenyList }()
+	denyList = map[string]bool{"password123a": true}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		classes  []string // Required classes, the default ones when nil
+		want     []string // Rules broken
+	}{
+		{"valid", "Correct7Horse", "ada@example.com", nil, nil},
+		{"too short", "Short7a", "ada@example.com", nil, []string{PasswordRuleMinLength}},
+		{"length counts characters", "Ünïcödé7ab", "ada@example.com", nil, nil},
+		{"too long for bcrypt", "Aa1" + strings.Repeat("a", 70), "ada@example.com", nil, []string{PasswordRuleMaxLength}},
+		{"no upper", "correct7horse", "ada@example.com", nil, []string{PasswordRuleUpper}},
+		{"no lower or digit", "CORRECTHORSE", "ada@example.com", nil, []string{PasswordRuleLower, PasswordRuleDigit}},
+		{"symbol required", "Correct7Horse", "ada@example.com", []string{"symbol"}, []string{PasswordRuleSymbol}},
+		{"symbol given", "correct horse!", "ada@example.com", []string{"symbol"}, nil},
+		{"no classes required", "correcthorse", "ada@example.com", []string{}, nil},
+		{"unknown classes are ignored", "correcthorse", "ada@example.com", []string{"emoji"}, nil},
+		{"common", "Password123A", "ada@example.com", nil, []string{PasswordRuleCommon}},
+		{"contains the email", "Xada@Example.com1", "ada@example.com", nil, []string{PasswordRuleEmail}},
+		{"contains the local part", "Lovelace7ada", "ada@example.com", nil, []string{PasswordRuleEmail}},
+		{"short local parts are ignored", "Lovelace7ab", "ab@example.com", nil, nil},
+		{"everything at once", "ada", "ada@example.com", nil, []string{PasswordRuleMinLength, PasswordRuleUpper, PasswordRuleDigit, PasswordRuleEmail}},
+	}
+	for _, test := range tests {
+		passwordRequiredClasses = []string{"lower", "upper", "digit"}
+		if test.classes != nil {
+			passwordRequiredClasses = test.classes
+		}
+
+		err := ValidatePassword(test.password, test.email)
+		var got []string
+		if err != nil {
+			policyErr, ok := err.(*PasswordPolicyError)
+			if !ok {
+				t.Fatalf("%s: error %T isn't a *PasswordPolicyError", test.name, err)
+			}
+			for _, violation := range policyErr.Violations {
+				got = append(got, violation.Rule)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: broken rules = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPasswordPolicyErrorMessage(t *testing.T) {
+	err := &PasswordPolicyError{Violations: []PasswordViolation{
+		{PasswordRuleUpper, "Password must contain an uppercase letter."},
+		{PasswordRuleDigit, "Password must contain a digit."},
+	}}
+	if want := "Password must contain an uppercase letter. Password must contain a digit."; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestLoadPasswordDenyList(t *testing.T) {
+	savedFile, savedDenyList := passwordDenyListFile, denyList
+	defer func() { passwordDenyListFile, denyList = savedFile, savedDenyList }()
+
+	if !isCommonPassword("Password123") {
+		t.Error("the built-in deny list doesn't refuse Password123")
+	}
+
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "custom.txt")
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(custom, []byte("# Custom\nHunter2Hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, []byte("# Nothing yet\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file    string
+		wantErr bool
+	}{
+		{"", false},
+		{filepath.Join(dir, "missing.txt"), true},
+		{empty, true},
+		{custom, false},
+	}
+	for _, test := range tests {
+		passwordDenyListFile = test.file
+		err := LoadPasswordDenyList()
+		if (err != nil) != test.wantErr {
+			t.Errorf("LoadPasswordDenyList with %q: error = %v, want error %v", test.file, err, test.wantErr)
+		}
+	}
+	if !isCommonPassword("hunter2hunter2") {
+		t.Error("the configured deny list wasn't loaded")
+	}
+}
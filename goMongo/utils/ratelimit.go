@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket: it holds up to Burst tokens, refills at Rate
+// tokens per second, and every request takes one token.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n requests a minute, all of which may come at once.
+func PerMinute(n int) RateLimit {
+	return RateLimit{Rate: float64(n) / 60, Burst: n}
+}
+
+// LockoutPolicy locks a key for Duration once MaxFailures failures happened
+// with less than Window between consecutive ones.
+type LockoutPolicy struct {
+	MaxFailures int
+	Window      time.Duration
+	Duration    time.Duration
+}
+
+// LimiterStore keeps the state of rate limits and lockouts. The in-memory
+// store is the default; deployments running several instances plug in a
+// shared store with SetLimiterStore.
+type LimiterStore interface {
+	// Take takes a token from the bucket of key. When none is left it
+	// returns false and how long until the next token.
+	Take(key string, limit RateLimit, now time.Time) (bool, time.Duration, error)
+	// Fail records a failure for key and returns until when key is locked,
+	// which is the zero time while it isn't.
+	Fail(key string, policy LockoutPolicy, now time.Time) (time.Time, error)
+	// LockedUntil returns until when key is locked.
+	LockedUntil(key string, now time.Time) (time.Time, error)
+	// Reset forgets the failures of key.
+	Reset(key string) error
+}
+
+// MemoryLimiterStore keeps limiter state in the process. Every instance of
+// the server counts on its own.
+type MemoryLimiterStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	failures map[string]*failureCount
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type failureCount struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// NewMemoryLimiterStore returns an empty in-memory store.
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{
+		buckets:  map[string]*tokenBucket{},
+		failures: map[string]*failureCount{},
+	}
+}
+
+func (s *MemoryLimiterStore) Take(key string, limit RateLimit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*limit.Rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false, RetryAfter(bucket.tokens, limit), nil
+	}
+	bucket.tokens--
+	s.prune(now, limit)
+	return true, 0, nil
+}
+
+func (s *MemoryLimiterStore) Fail(key string, policy LockoutPolicy, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failure, ok := s.failures[key]
+	if ok && now.Before(failure.lockedUntil) {
+		return failure.lockedUntil, nil
+	}
+	if !ok || now.Sub(failure.last) > policy.Window {
+		failure = &failureCount{}
+		s.failures[key] = failure
+	}
+
+	failure.count++
+	failure.last = now
+	if failure.count >= policy.MaxFailures {
+		failure.count = 0
+		failure.lockedUntil = now.Add(policy.Duration)
+		return failure.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryLimiterStore) LockedUntil(key string, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if failure, ok := s.failures[key]; ok && now.Before(failure.lockedUntil) {
+		return failure.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryLimiterStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+// prune drops buckets that have refilled completely, since they behave the
+// same as missing ones, so the maps don't grow with every client seen.
+func (s *MemoryLimiterStore) prune(now time.Time, limit RateLimit) {
+	if len(s.buckets) < 10000 {
+		return
+	}
+	full := time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second))
+	for key, bucket := range s.buckets {
+		if now.Sub(bucket.updated) > full {
+			delete(s.buckets, key)
+		}
+	}
+	for key, failure := range s.failures {
+		if now.After(failure.lockedUntil) && now.Sub(failure.last) > full {
+			delete(s.failures, key)
+		}
+	}
+}
+
+// RetryAfter is how long a bucket holding tokens takes to refill to one.
+func RetryAfter(tokens float64, limit RateLimit) time.Duration {
+	return time.Duration(math.Ceil((1-tokens)/limit.Rate)) * time.Second
+}
+
+var (
+	limiterMu    sync.RWMutex
+	limiterStore LimiterStore = NewMemoryLimiterStore()
+)
+
+// SetLimiterStore replaces the store used by the limiter functions.
+func SetLimiterStore(store LimiterStore) {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	limiterStore = store
+}
+
+func currentLimiterStore() LimiterStore {
+	limiterMu.RLock()
+	defer limiterMu.RUnlock()
+	return limiterStore
+}
+
+// TakeToken takes a token for key from the configured store.
+func TakeToken(key string, limit RateLimit) (bool, time.Duration, error) {
+	return currentLimiterStore().Take(key, limit, time.Now())
+}
+
+// RecordFailure records a failure for key in the configured store.
+func RecordFailure(key string, policy LockoutPolicy) (time.Time, error) {
+	return currentLimiterStore().Fail(key, policy, time.Now())
+}
+
+// LockedUntil returns until when key is locked in the configured store.
+func LockedUntil(key string) (time.Time, error) {
+	return currentLimiterStore().LockedUntil(key, time.Now())
+}
+
+// ResetFailures forgets the failures of key in the configured store.
+func ResetFailures(key string) error {
+	return currentLimiterStore().Reset(key)
+}
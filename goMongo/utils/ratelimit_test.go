@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiterStoreTake(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := PerMinute(3)
+
+	tests := []struct {
+		name       string
+		after      time.Duration
+		key        string
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{"first of the burst", 0, "a", true, 0},
+		{"second of the burst", 0, "a", true, 0},
+		{"last of the burst", 0, "a", true, 0},
+		{"burst used up", 0, "a", false, 20 * time.Second},
+		{"other keys have their own bucket", 0, "b", true, 0},
+		{"partly refilled", 10 * time.Second, "a", false, 10 * time.Second},
+		{"refilled one token", 20 * time.Second, "a", true, 0},
+		{"that token is used", 20 * time.Second, "a", false, 20 * time.Second},
+		{"refills up to the burst only", time.Hour, "a", true, 0},
+	}
+
+	store := NewMemoryLimiterStore()
+	for _, test := range tests {
+		allowed, retryAfter, err := store.Take(test.key, limit, start.Add(test.after))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if allowed != test.allowed || retryAfter != test.retryAfter {
+			t.Errorf("%s: Take = %v, %v, want %v, %v", test.name, allowed, retryAfter, test.allowed, test.retryAfter)
+		}
+	}
+
+	// A full bucket holds Burst tokens, not more
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := store.Take("a", limit, start.Add(time.Hour)); !allowed {
+			t.Fatalf("token %d of the refilled burst was refused", i+2)
+		}
+	}
+	if allowed, _, _ := store.Take("a", limit, start.Add(time.Hour)); allowed {
+		t.Error("took more tokens than the burst")
+	}
+}
+
+func TestMemoryLimiterStoreLockout(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := LockoutPolicy{MaxFailures: 3, Window: time.Minute, Duration: 15 * time.Minute}
+	lockedUntil := start.Add(2*time.Minute + policy.Duration)
+
+	tests := []struct {
+		name   string
+		after  time.Duration
+		reset  bool
+		locked time.Time
+	}{
+		{"first failure", 0, false, time.Time{}},
+		{"second failure", time.Minute, false, time.Time{}},
+		{"third failure locks", 2 * time.Minute, false, lockedUntil},
+		{"failures while locked keep the lock", 3 * time.Minute, false, lockedUntil},
+		{"failure after the lock starts over", 2*time.Minute + policy.Duration, false, time.Time{}},
+		{"failures further apart than the window start over", 4*time.Minute + policy.Duration, false, time.Time{}},
+		{"second failure in the new window", 5*time.Minute + policy.Duration, false, time.Time{}},
+		{"reset forgets failures", 5*time.Minute + policy.Duration, true, time.Time{}},
+		{"first failure after the reset", 6*time.Minute + policy.Duration, false, time.Time{}},
+	}
+
+	store := NewMemoryLimiterStore()
+	for _, test := range tests {
+		now := start.Add(test.after)
+		if test.reset {
+			if err := store.Reset("user"); err != nil {
+				t.Fatal(err)
+			}
+			if until, _ := store.LockedUntil("user", now); !until.IsZero() {
+				t.Errorf("%s: locked until %v after reset", test.name, until)
+			}
+			continue
+		}
+		locked, err := store.Fail("user", policy, now)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !locked.Equal(test.locked) {
+			t.Errorf("%s: Fail = %v, want %v", test.name, locked, test.locked)
+		}
+		if until, _ := store.LockedUntil("user", now); !until.Equal(test.locked) {
+			t.Errorf("%s: LockedUntil = %v, want %v", test.name, until, test.locked)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		tokens float64
+		limit  RateLimit
+		want   time.Duration
+	}{
+		{0, PerMinute(60), time.Second},
+		{0, PerMinute(6), 10 * time.Second},
+		{0.5, PerMinute(6), 5 * time.Second},
+		{0.99, PerMinute(6), time.Second},
+		{0, RateLimit{Rate: 0.4, Burst: 1}, 3 * time.Second},
+	}
+	for _, test := range tests {
+		if got := RetryAfter(test.tokens, test.limit); got != test.want {
+			t.Errorf("RetryAfter(%v, %+v) = %v, want %v", test.tokens, test.limit, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRRulePeriods bounds how many periods an expansion walks through, so a
+// rule that never produces a date can't spin forever.
+const maxRRulePeriods = 50000
+
+// WeekdayNum is a BYDAY entry such as MO, 2TU or -1FR.
+type WeekdayNum struct {
+	N   int // 0 means every such weekday in the period
+	Day time.Weekday
+}
+
+// RRule is the subset of an RFC 5545 recurrence rule that event series use:
+// FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, COUNT, UNTIL, BYDAY and
+// BYMONTHDAY. Weeks start on Monday.
+type RRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// ParseRRule parses a recurrence rule, with or without the "RRULE:" prefix.
+func ParseRRule(rule string) (*RRule, error) {
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if rule == "" {
+		return nil, errors.New("empty recurrence rule")
+	}
+
+	r := &RRule{Interval: 1}
+	for _, part := range strings.Split(rule, ";") {
+		name, value, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("malformed recurrence rule part %q", part)
+		}
+
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			switch value = strings.ToUpper(value); value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.Freq = value
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			until, err := parseRRuleUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = until
+		case "BYDAY":
+			for _, entry := range strings.Split(value, ",") {
+				day, err := parseWeekdayNum(entry)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, entry := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(entry)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", entry)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "WKST":
+			if strings.ToUpper(value) != "MO" {
+				return nil, errors.New("only WKST=MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported recurrence rule part %q", name)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("recurrence rule requires FREQ")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, errors.New("COUNT and UNTIL can't both be set")
+	}
+	for _, day := range r.ByDay {
+		if day.N != 0 && r.Freq != "MONTHLY" {
+			return nil, errors.New("numbered BYDAY entries are only supported with FREQ=MONTHLY")
+		}
+	}
+	if len(r.ByDay) > 0 && r.Freq != "WEEKLY" && r.Freq != "MONTHLY" {
+		return nil, errors.New("BYDAY is only supported with FREQ=WEEKLY or FREQ=MONTHLY")
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != "MONTHLY" {
+		return nil, errors.New("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	if len(r.ByMonthDay) > 0 && len(r.ByDay) > 0 {
+		return nil, errors.New("BYDAY and BYMONTHDAY can't be combined")
+	}
+
+	return r, nil
+}
+
+// String renders the rule back into RRULE value syntax.
+func (r *RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = day.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+func (w WeekdayNum) String() string {
+	code := strings.ToUpper(w.Day.String()[:2])
+	if w.N == 0 {
+		return code
+	}
+	return strconv.Itoa(w.N) + code
+}
+
+// Between expands the rule from dtstart and returns the occurrence starts in
+// [from, to). Dates are generated in loc so that a weekly 19:00 meetup stays
+// at 19:00 local time across daylight saving changes.
+func (r *RRule) Between(dtstart time.Time, loc *time.Location, from, to time.Time) []time.Time {
+	start := dtstart.In(loc)
+	emitted := 0
+	var occurrences []time.Time
+
+	for period := 0; period < maxRRulePeriods; period++ {
+		for _, candidate := range r.periodCandidates(start, loc, period) {
+			if candidate.Before(start) {
+				continue
+			}
+			if !r.Until.IsZero() && candidate.After(r.Until) {
+				return occurrences
+			}
+			emitted++
+			if r.Count > 0 && emitted > r.Count {
+				return occurrences
+			}
+			if !candidate.Before(to) {
+				return occurrences
+			}
+			if !candidate.Before(from) {
+				occurrences = append(occurrences, candidate.UTC())
+			}
+		}
+	}
+
+	return occurrences
+}
+
+// periodCandidates returns the sorted dates the rule produces in the n-th
+// period (day, week, month or year) counted from start.
+func (r *RRule) periodCandidates(start time.Time, loc *time.Location, n int) []time.Time {
+	hour, minute, second := start.Clock()
+	at := func(year int, month time.Month, day int) (time.Time, bool) {
+		t := time.Date(year, month, day, hour, minute, second, 0, loc)
+		// time.Date normalizes overflowing days, e.g. February 30th
+		return t, t.Day() == day && t.Month() == month
+	}
+
+	var candidates []time.Time
+	step := n * r.Interval
+
+	switch r.Freq {
+	case "DAILY":
+		candidates = append(candidates, time.Date(start.Year(), start.Month(), start.Day()+step, hour, minute, second, 0, loc))
+	case "WEEKLY":
+		// Monday of the week containing start
+		offset := (int(start.Weekday()) + 6) % 7
+		monday := time.Date(start.Year(), start.Month(), start.Day()-offset+7*step, hour, minute, second, 0, loc)
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []WeekdayNum{{Day: start.Weekday()}}
+		}
+		for _, day := range days {
+			candidates = append(candidates, monday.AddDate(0, 0, (int(day.Day)+6)%7))
+		}
+	case "MONTHLY":
+		first := time.Date(start.Year(), start.Month()+time.Month(step), 1, 0, 0, 0, 0, loc)
+		year, month := first.Year(), first.Month()
+		daysInMonth := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+
+		switch {
+		case len(r.ByMonthDay) > 0:
+			for _, day := range r.ByMonthDay {
+				if day < 0 {
+					day = daysInMonth + day + 1
+				}
+				if t, ok := at(year, month, day); ok {
+					candidates = append(candidates, t)
+				}
+			}
+		case len(r.ByDay) > 0:
+			for _, weekday := range r.ByDay {
+				var matches []int
+				for day := 1; day <= daysInMonth; day++ {
+					if time.Date(year, month, day, 0, 0, 0, 0, loc).Weekday() == weekday.Day {
+						matches = append(matches, day)
+					}
+				}
+				switch {
+				case weekday.N == 0:
+					for _, day := range matches {
+						t, _ := at(year, month, day)
+						candidates = append(candidates, t)
+					}
+				case weekday.N > 0 && weekday.N <= len(matches):
+					t, _ := at(year, month, matches[weekday.N-1])
+					candidates = append(candidates, t)
+				case weekday.N < 0 && -weekday.N <= len(matches):
+					t, _ := at(year, month, matches[len(matches)+weekday.N])
+					candidates = append(candidates, t)
+				}
+			}
+		default:
+			if t, ok := at(year, month, start.Day()); ok {
+				candidates = append(candidates, t)
+			}
+		}
+	case "YEARLY":
+		if t, ok := at(start.Year()+step, start.Month(), start.Day()); ok {
+			candidates = append(candidates, t)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	return candidates
+}
+
+func parseRRuleUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A bare date includes the whole day
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
+
+func parseWeekdayNum(entry string) (WeekdayNum, error) {
+	entry = strings.ToUpper(strings.TrimSpace(entry))
+	if len(entry) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", entry)
+	}
+
+	day, ok := weekdayCodes[entry[len(entry)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", entry)
+	}
+
+	n := 0
+	if prefix := entry[:len(entry)-2]; prefix != "" {
+		var err error
+		n, err = strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", entry)
+		}
+	}
+
+	return WeekdayNum{N: n, Day: day}, nil
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    string // Normalized by String, empty when parsing fails
+		wantErr bool
+	}{
+		{rule: "FREQ=DAILY", want: "FREQ=DAILY"},
+		{rule: "RRULE:freq=weekly;byday=tu,th", want: "FREQ=WEEKLY;BYDAY=TU,TH"},
+		{rule: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", want: "FREQ=MONTHLY;COUNT=3;BYDAY=-1FR"},
+		{rule: "FREQ=DAILY;INTERVAL=1;UNTIL=20240105", want: "FREQ=DAILY;UNTIL=20240105T235959Z"},
+		{rule: "FREQ=WEEKLY;INTERVAL=2;WKST=MO", want: "FREQ=WEEKLY;INTERVAL=2"},
+		{rule: "FREQ=MONTHLY;BYMONTHDAY=1,-1", want: "FREQ=MONTHLY;BYMONTHDAY=1,-1"},
+		{rule: "", wantErr: true},
+		{rule: "INTERVAL=2", wantErr: true},
+		{rule: "FREQ=HOURLY", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT=0", wantErr: true},
+		{rule: "FREQ=DAILY;INTERVAL=-1", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT=2;UNTIL=20240101", wantErr: true},
+		{rule: "FREQ=DAILY;UNTIL=tomorrow", wantErr: true},
+		{rule: "FREQ=DAILY;BYDAY=MO", wantErr: true},
+		{rule: "FREQ=WEEKLY;BYDAY=2TU", wantErr: true},
+		{rule: "FREQ=MONTHLY;BYDAY=6MO", wantErr: true},
+		{rule: "FREQ=MONTHLY;BYDAY=XX", wantErr: true},
+		{rule: "FREQ=MONTHLY;BYMONTHDAY=0", wantErr: true},
+		{rule: "FREQ=MONTHLY;BYMONTHDAY=32", wantErr: true},
+		{rule: "FREQ=WEEKLY;BYMONTHDAY=1", wantErr: true},
+		{rule: "FREQ=MONTHLY;BYDAY=MO;BYMONTHDAY=1", wantErr: true},
+		{rule: "FREQ=WEEKLY;WKST=SU", wantErr: true},
+		{rule: "FREQ=DAILY;BYHOUR=9", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT", wantErr: true},
+	}
+	for _, test := range tests {
+		rule, err := ParseRRule(test.rule)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseRRule(%q) error = %v, want error %v", test.rule, err, test.wantErr)
+			continue
+		}
+		if err == nil && rule.String() != test.want {
+			t.Errorf("ParseRRule(%q).String() = %q, want %q", test.rule, rule.String(), test.want)
+		}
+	}
+}
+
+func TestRRuleBetween(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		rule     string
+		dtstart  time.Time
+		loc      *time.Location
+		from, to time.Time
+		want     []time.Time
+	}{
+		{
+			name:    "daily count",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: utc(2024, 1, 1, 10), loc: time.UTC,
+			from: utc(2024, 1, 1, 0), to: utc(2025, 1, 1, 0),
+			want: []time.Time{utc(2024, 1, 1, 10), utc(2024, 1, 2, 10), utc(2024, 1, 3, 10)},
+		},
+		{
+			name:    "count is counted from dtstart, not from the window",
+			rule:    "FREQ=DAILY;COUNT=5",
+			dtstart: utc(2024, 1, 1, 10), loc: time.UTC,
+			from: utc(2024, 1, 3, 0), to: utc(2024, 1, 10, 0),
+			want: []time.Time{utc(2024, 1, 3, 10), utc(2024, 1, 4, 10), utc(2024, 1, 5, 10)},
+		},
+		{
+			name:    "until a date includes that day",
+			rule:    "FREQ=DAILY;UNTIL=20240103",
+			dtstart: utc(2024, 1, 1, 22), loc: time.UTC,
+			from: utc(2024, 1, 1, 0), to: utc(2024, 2, 1, 0),
+			want: []time.Time{utc(2024, 1, 1, 22), utc(2024, 1, 2, 22), utc(2024, 1, 3, 22)},
+		},
+		{
+			name:    "weekly on two days",
+			rule:    "FREQ=WEEKLY;BYDAY=TU,TH",
+			dtstart: utc(2024, 1, 2, 19), loc: time.UTC,
+			from: utc(2024, 1, 1, 0), to: utc(2024, 1, 12, 0),
+			want: []time.Time{utc(2024, 1, 2, 19), utc(2024, 1, 4, 19), utc(2024, 1, 9, 19), utc(2024, 1, 11, 19)},
+		},
+		{
+			name:    "every other week",
+			rule:    "FREQ=WEEKLY;INTERVAL=2",
+			dtstart: utc(2024, 1, 1, 9), loc: time.UTC,
+			from: utc(2024, 1, 1, 0), to: utc(2024, 2, 1, 0),
+			want: []time.Time{utc(2024, 1, 1, 9), utc(2024, 1, 15, 9), utc(2024, 1, 29, 9)},
+		},
+		{
+			name:    "window ends before to",
+			rule:    "FREQ=DAILY",
+			dtstart: utc(2024, 1, 1, 10), loc: time.UTC,
+			from: utc(2024, 1, 1, 0), to: utc(2024, 1, 3, 10),
+			want: []time.Time{utc(2024, 1, 1, 10), utc(2024, 1, 2, 10)},
+		},
+		{
+			name:    "last Friday of the month",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: utc(2024, 1, 26, 18), loc: time.UTC,
+			from: utc(2024, 1, 1, 0), to: utc(2025, 1, 1, 0),
+			want: []time.Time{utc(2024, 1, 26, 18), utc(2024, 2, 23, 18), utc(2024, 3, 29, 18)},
+		},
+		{
+			name:    "31st skips shorter months",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=31",
+			dtstart: utc(2024, 1, 31, 12), loc: time.UTC,
+			from: utc(2024, 1, 1, 0), to: utc(2024, 6, 1, 0),
+			want: []time.Time{utc(2024, 1, 31, 12), utc(2024, 3, 31, 12), utc(2024, 5, 31, 12)},
+		},
+		{
+			name:    "last day of the month",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-1",
+			dtstart: utc(2024, 1, 31, 12), loc: time.UTC,
+			from: utc(2024, 1, 1, 0), to: utc(2024, 5, 1, 0),
+			want: []time.Time{utc(2024, 1, 31, 12), utc(2024, 2, 29, 12), utc(2024, 3, 31, 12), utc(2024, 4, 30, 12)},
+		},
+		{
+			name:    "leap day only in leap years",
+			rule:    "FREQ=YEARLY;COUNT=2",
+			dtstart: utc(2024, 2, 29, 12), loc: time.UTC,
+			from: utc(2024, 1, 1, 0), to: utc(2030, 1, 1, 0),
+			want: []time.Time{utc(2024, 2, 29, 12), utc(2028, 2, 29, 12)},
+		},
+		{
+			name: "local time kept across daylight saving",
+			rule: "FREQ=WEEKLY",
+			// 19:00 in Amsterdam, which moves from UTC+1 to UTC+2 on March 31st
+			dtstart: time.Date(2024, 3, 26, 19, 0, 0, 0, amsterdam), loc: amsterdam,
+			from: utc(2024, 3, 1, 0), to: utc(2024, 4, 8, 0),
+			want: []time.Time{utc(2024, 3, 26, 18), utc(2024, 4, 2, 17)},
+		},
+	}
+	for _, test := range tests {
+		rule, err := ParseRRule(test.rule)
+		if err != nil {
+			t.Fatalf("%s: ParseRRule(%q): %v", test.name, test.rule, err)
+		}
+		got := rule.Between(test.dtstart, test.loc, test.from, test.to)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: Between = %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Equal(test.want[i]) {
+				t.Errorf("%s: Between = %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRRuleBetweenTerminates(t *testing.T) {
+	// February 30th never comes, the expansion has to give up on its own
+	rule, err := ParseRRule("FREQ=MONTHLY;BYMONTHDAY=30;INTERVAL=12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)
+	if got := rule.Between(start, time.UTC, start, start.AddDate(1, 0, 0)); len(got) != 0 {
+		t.Errorf("Between = %v, want no occurrences", got)
+	}
+}
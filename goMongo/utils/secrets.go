@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"example.com/goMongo/config"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Secrets that sign or encrypt what we hand out or store have no default,
+// since a default would be in this repository for anyone to read. main
+// refuses to start until they are set:
+//
+//	JWT_SECRET          signs access tokens with HS256, see LoadSigningKeys
+//	TICKET_SECRET       signs check-in tickets
+//	CALENDAR_SECRET     signs calendar feed tokens
+//	MFA_ENCRYPTION_KEY  encrypts TOTP secrets, see EncryptSecret
+
+// Shortest secret we accept, so a placeholder like "secret" isn't used
+const minSecretLength = 32
+
+var (
+	ticketSecret   []byte
+	calendarSecret []byte
+	mfaKey         []byte // AES-256 key derived from MFA_ENCRYPTION_KEY
+	legacyMFAKey   []byte // SHA-256 of MFA_ENCRYPTION_KEY, how the key used to be derived
+)
+
+// LoadSecrets reads the secrets from the configuration.
+func LoadSecrets() error {
+	var err error
+	if ticketSecret, err = requiredSecret("TICKET_SECRET"); err != nil {
+		return err
+	}
+	if calendarSecret, err = requiredSecret("CALENDAR_SECRET"); err != nil {
+		return err
+	}
+	mfaSecret, err := requiredSecret("MFA_ENCRYPTION_KEY")
+	if err != nil {
+		return err
+	}
+	return setMFAKey(mfaSecret)
+}
+
+func setMFAKey(secret []byte) error {
+	key, err := deriveKey(secret, "mfa secret encryption")
+	if err != nil {
+		return err
+	}
+	legacy := sha256.Sum256(secret)
+	mfaKey, legacyMFAKey = key, legacy[:]
+	return nil
+}
+
+// deriveKey derives a 256-bit key for one purpose from a secret with HKDF,
+// so a secret is never used as a key directly.
+func deriveKey(secret []byte, purpose string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte("goMongo "+purpose)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func requiredSecret(key string) ([]byte, error) {
+	value := config.String(key, "")
+	if value == "" {
+		return nil, fmt.Errorf("%s is not set", key)
+	}
+	if len(value) < minSecretLength {
+		return nil, fmt.Errorf("%s must be at least %d characters long", key, minSecretLength)
+	}
+	return []byte(value), nil
+}
@@ -0,0 +1,311 @@
+package utils
+
+import "strings"
+
+// Stem reduces an English word to its stem with the Porter2 (Snowball
+// English) algorithm, which MongoDB text indexes use for English. Words a
+// $text search matched have the same stem as one of the search terms.
+// See https://snowballstem.org/algorithms/english/stemmer.html
+func Stem(word string) string {
+	word = strings.ToLower(word)
+	if stem, ok := stemExceptions[word]; ok {
+		return stem
+	}
+	if len(word) < 3 {
+		return word
+	}
+
+	s := &stemmer{w: []byte(strings.TrimPrefix(word, "'"))}
+	if len(s.w) == 0 {
+		return word
+	}
+	s.prelude()
+	s.markRegions()
+
+	s.step0()
+	s.step1a()
+	if stemInvariants[string(s.w)] {
+		return s.postlude()
+	}
+	s.step1b()
+	s.step1c()
+	s.step2()
+	s.step3()
+	s.step4()
+	s.step5()
+	return s.postlude()
+}
+
+// Words the algorithm would get wrong, with their stems
+var stemExceptions = map[string]string{
+	"skis":   "ski",
+	"skies":  "sky",
+	"dying":  "die",
+	"lying":  "lie",
+	"tying":  "tie",
+	"idly":   "idl",
+	"gently": "gentl",
+	"ugly":   "ugli",
+	"early":  "earli",
+	"only":   "onli",
+	"singly": "singl",
+	"sky":    "sky",
+	"news":   "news",
+	"howe":   "howe",
+	"atlas":  "atlas",
+	"cosmos": "cosmos",
+	"bias":   "bias",
+	"andes":  "andes",
+}
+
+// Words left alone once step 1a removed their plural
+var stemInvariants = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true,
+	"earring": true, "proceed": true, "exceed": true, "succeed": true,
+}
+
+type stemmer struct {
+	w      []byte
+	r1, r2 int // Start of the regions R1 and R2
+}
+
+func isStemVowel(c byte) bool {
+	switch c {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+func (s *stemmer) hasSuffix(suffix string) bool {
+	return strings.HasSuffix(string(s.w), suffix)
+}
+
+// longestSuffix returns the longest of suffixes the word ends with, or "".
+func (s *stemmer) longestSuffix(suffixes ...string) string {
+	longest := ""
+	for _, suffix := range suffixes {
+		if len(suffix) > len(longest) && s.hasSuffix(suffix) {
+			longest = suffix
+		}
+	}
+	return longest
+}
+
+func (s *stemmer) inR1(suffix string) bool { return len(s.w)-len(suffix) >= s.r1 }
+func (s *stemmer) inR2(suffix string) bool { return len(s.w)-len(suffix) >= s.r2 }
+
+func (s *stemmer) replace(suffix, with string) {
+	s.w = append(s.w[:len(s.w)-len(suffix)], with...)
+}
+
+// hasVowelBefore reports whether the word has a vowel before position end.
+func (s *stemmer) hasVowelBefore(end int) bool {
+	for _, c := range s.w[:end] {
+		if isStemVowel(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsShortSyllable reports whether w ends in a short syllable: a vowel
+// followed by a non-vowel other than w, x or Y and preceded by a non-vowel,
+// or a vowel at the start of the word followed by a non-vowel.
+func endsShortSyllable(w []byte) bool {
+	n := len(w)
+	if n == 2 {
+		return isStemVowel(w[0]) && !isStemVowel(w[1])
+	}
+	return n >= 3 && !isStemVowel(w[n-3]) && isStemVowel(w[n-2]) && !isStemVowel(w[n-1]) &&
+		w[n-1] != 'w' && w[n-1] != 'x' && w[n-1] != 'Y'
+}
+
+func (s *stemmer) isShortWord() bool {
+	return endsShortSyllable(s.w) && s.r1 >= len(s.w)
+}
+
+// prelude marks the y's that act as consonants as Y.
+func (s *stemmer) prelude() {
+	if s.w[0] == 'y' {
+		s.w[0] = 'Y'
+	}
+	for i := 1; i < len(s.w); i++ {
+		if s.w[i] == 'y' && isStemVowel(s.w[i-1]) {
+			s.w[i] = 'Y'
+		}
+	}
+}
+
+// markRegions finds R1, the region after the first non-vowel following a
+// vowel, and R2, the same region within R1.
+func (s *stemmer) markRegions() {
+	s.r1 = len(s.w)
+	s.r2 = len(s.w)
+	for _, prefix := range []string{"gener", "commun", "arsen"} {
+		if strings.HasPrefix(string(s.w), prefix) {
+			s.r1 = len(prefix)
+		}
+	}
+	if s.r1 == len(s.w) {
+		s.r1 = regionStart(s.w, 0)
+	}
+	s.r2 = regionStart(s.w, s.r1)
+}
+
+func regionStart(w []byte, from int) int {
+	for i := from + 1; i < len(w); i++ {
+		if !isStemVowel(w[i]) && isStemVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+func (s *stemmer) postlude() string {
+	return strings.ReplaceAll(string(s.w), "Y", "y")
+}
+
+// step0 removes possessives.
+func (s *stemmer) step0() {
+	if suffix := s.longestSuffix("'s'", "'s", "'"); suffix != "" {
+		s.replace(suffix, "")
+	}
+}
+
+// step1a removes plurals.
+func (s *stemmer) step1a() {
+	switch suffix := s.longestSuffix("sses", "ied", "ies", "us", "ss", "s"); suffix {
+	case "sses":
+		s.replace(suffix, "ss")
+	case "ied", "ies":
+		if len(s.w) > 4 {
+			s.replace(suffix, "i")
+		} else {
+			s.replace(suffix, "ie")
+		}
+	case "s":
+		// Only when a vowel comes before the letter before the s, so gas
+		// and this keep theirs
+		if s.hasVowelBefore(len(s.w) - 2) {
+			s.replace(suffix, "")
+		}
+	}
+}
+
+// step1b removes past tenses and gerunds.
+func (s *stemmer) step1b() {
+	switch suffix := s.longestSuffix("eed", "eedly", "ed", "edly", "ing", "ingly"); suffix {
+	case "eed", "eedly":
+		if s.inR1(suffix) {
+			s.replace(suffix, "ee")
+		}
+	case "ed", "edly", "ing", "ingly":
+		if !s.hasVowelBefore(len(s.w) - len(suffix)) {
+			return
+		}
+		s.replace(suffix, "")
+		switch {
+		case s.hasSuffix("at"), s.hasSuffix("bl"), s.hasSuffix("iz"):
+			s.w = append(s.w, 'e')
+		case s.longestSuffix("bb", "dd", "ff", "gg", "mm", "nn", "pp", "rr", "tt") != "":
+			s.w = s.w[:len(s.w)-1]
+		case s.isShortWord():
+			s.w = append(s.w, 'e')
+		}
+	}
+}
+
+// step1c turns a final y after a consonant into i.
+func (s *stemmer) step1c() {
+	n := len(s.w)
+	if n > 2 && (s.w[n-1] == 'y' || s.w[n-1] == 'Y') && !isStemVowel(s.w[n-2]) {
+		s.w[n-1] = 'i'
+	}
+}
+
+var step2Suffixes = map[string]string{
+	"tional": "tion", "enci": "ence", "anci": "ance", "abli": "able",
+	"entli": "ent", "izer": "ize", "ization": "ize", "ational": "ate",
+	"ation": "ate", "ator": "ate", "alism": "al", "aliti": "al", "alli": "al",
+	"fulness": "ful", "ousli": "ous", "ousness": "ous", "iveness": "ive",
+	"iviti": "ive", "biliti": "ble", "bli": "ble", "ogi": "og", "fulli": "ful",
+	"lessli": "less", "li": "",
+}
+
+var step3Suffixes = map[string]string{
+	"tional": "tion", "ational": "ate", "alize": "al", "icate": "ic",
+	"iciti": "ic", "ical": "ic", "ful": "", "ness": "", "ative": "",
+}
+
+func (s *stemmer) longestOf(suffixes map[string]string) string {
+	longest := ""
+	for suffix := range suffixes {
+		if len(suffix) > len(longest) && s.hasSuffix(suffix) {
+			longest = suffix
+		}
+	}
+	return longest
+}
+
+// step2 maps double suffixes to single ones.
+func (s *stemmer) step2() {
+	suffix := s.longestOf(step2Suffixes)
+	if suffix == "" || !s.inR1(suffix) {
+		return
+	}
+	before := len(s.w) - len(suffix) - 1
+	switch suffix {
+	case "ogi":
+		if before < 0 || s.w[before] != 'l' {
+			return
+		}
+	case "li":
+		if before < 0 || !strings.ContainsRune("cdeghkmnrt", rune(s.w[before])) {
+			return
+		}
+	}
+	s.replace(suffix, step2Suffixes[suffix])
+}
+
+// step3 deals with -ic-, -full, -ness and the like.
+func (s *stemmer) step3() {
+	suffix := s.longestOf(step3Suffixes)
+	if suffix == "" || !s.inR1(suffix) {
+		return
+	}
+	if suffix == "ative" && !s.inR2(suffix) {
+		return
+	}
+	s.replace(suffix, step3Suffixes[suffix])
+}
+
+// step4 removes suffixes within R2.
+func (s *stemmer) step4() {
+	suffix := s.longestSuffix("al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement",
+		"ment", "ent", "ism", "ate", "iti", "ous", "ive", "ize", "ion")
+	if suffix == "" || !s.inR2(suffix) {
+		return
+	}
+	if suffix == "ion" {
+		before := len(s.w) - len(suffix) - 1
+		if before < 0 || (s.w[before] != 's' && s.w[before] != 't') {
+			return
+		}
+	}
+	s.replace(suffix, "")
+}
+
+// step5 removes a final e or double l.
+func (s *stemmer) step5() {
+	switch {
+	case s.hasSuffix("e"):
+		if s.inR2("e") || (s.inR1("e") && !endsShortSyllable(s.w[:len(s.w)-1])) {
+			s.replace("e", "")
+		}
+	case s.hasSuffix("l"):
+		if s.inR2("l") && s.hasSuffix("ll") {
+			s.replace("l", "")
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package utils
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	// From the Snowball English vocabulary and its expected output
+	tests := map[string]string{
+		"caresses":      "caress",
+		"flies":         "fli",
+		"dies":          "die",
+		"mules":         "mule",
+		"denied":        "deni",
+		"died":          "die",
+		"agreed":        "agre",
+		"owned":         "own",
+		"humbled":       "humbl",
+		"sized":         "size",
+		"meeting":       "meet",
+		"stating":       "state",
+		"siezing":       "siez",
+		"itemization":   "item",
+		"sensational":   "sensat",
+		"traditional":   "tradit",
+		"reference":     "refer",
+		"colonizer":     "colon",
+		"plotted":       "plot",
+		"consign":       "consign",
+		"consigned":     "consign",
+		"consignment":   "consign",
+		"consistency":   "consist",
+		"consistently":  "consist",
+		"generate":      "generat",
+		"generously":    "generous",
+		"generically":   "generic",
+		"knackeries":    "knackeri",
+		"kneaded":       "knead",
+		"happiness":     "happi",
+		"running":       "run",
+		"parties":       "parti",
+		"party":         "parti",
+		"art":           "art",
+		"arts":          "art",
+		"gas":           "gas",
+		"this":          "this",
+		"gaps":          "gap",
+		"kiwis":         "kiwi",
+		"ties":          "tie",
+		"cries":         "cri",
+		"hopping":       "hop",
+		"hoping":        "hope",
+		"communication": "communic",
+		"arsenal":       "arsenal",
+		"yelling":       "yell",
+		"sayings":       "say",
+		"ladies'":       "ladi",
+		"john's":        "john",
+		"skies":         "sky",
+		"dying":         "die",
+		"news":          "news",
+		"inning":        "inning",
+		"innings":       "inning",
+		"succeeded":     "succeed",
+		"hopefully":     "hope",
+		"electrical":    "electr",
+		"be":            "be",
+		"Meetups":       "meetup",
+	}
+	for word, want := range tests {
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
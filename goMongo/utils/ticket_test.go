@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTicketCode(t *testing.T) {
+	ticketSecret = []byte("0123456789abcdef0123456789abcdef")
+
+	registrationId := primitive.NewObjectID()
+	eventId := primitive.NewObjectID()
+	code := GenerateTicketCode(registrationId, eventId)
+
+	gotRegistration, gotEvent, err := VerifyTicketCode(code)
+	if err != nil {
+		t.Fatalf("VerifyTicketCode(valid code) failed: %v", err)
+	}
+	if gotRegistration != registrationId || gotEvent != eventId {
+		t.Errorf("VerifyTicketCode = %s, %s, want %s, %s", gotRegistration.Hex(), gotEvent.Hex(), registrationId.Hex(), eventId.Hex())
+	}
+
+	payload, signature, _ := strings.Cut(code, ".")
+	otherEvent := base64.RawURLEncoding.EncodeToString([]byte(registrationId.Hex() + "." + primitive.NewObjectID().Hex()))
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"empty", ""},
+		{"no signature", payload},
+		{"bad base64", "!!!." + signature},
+		{"tampered payload", otherEvent + "." + signature},
+		{"tampered signature", payload + "." + strings.Repeat("A", len(signature))},
+		{"not ObjectIDs", base64.RawURLEncoding.EncodeToString([]byte("a.b")) + "." + signTicket("a.b")},
+	}
+	for _, test := range tests {
+		if _, _, err := VerifyTicketCode(test.code); err == nil {
+			t.Errorf("%s: VerifyTicketCode(%q) succeeded, want an error", test.name, test.code)
+		}
+	}
+
+	// Codes signed with another secret are forgeries
+	ticketSecret = []byte("fedcba9876543210fedcba9876543210")
+	if _, _, err := VerifyTicketCode(code); err == nil {
+		t.Error("VerifyTicketCode accepted a code signed with another secret")
+	}
+}
+
+func TestRequiredSecret(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"", true},
+		{"ticketsecretkey", true},
+		{strings.Repeat("x", minSecretLength-1), true},
+		{strings.Repeat("x", minSecretLength), false},
+	}
+	for _, test := range tests {
+		t.Setenv("TEST_SECRET", test.value)
+		_, err := requiredSecret("TEST_SECRET")
+		if (err != nil) != test.wantErr {
+			t.Errorf("requiredSecret with %q: error = %v, want error %v", test.value, err, test.wantErr)
+		}
+	}
+}
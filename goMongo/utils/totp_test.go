@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Base32 of the RFC 6238 SHA-1 test secret "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B, cut down to the last six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, test := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, test.code, time.Unix(test.unix, 0))
+		if !ok {
+			t.Errorf("ValidateTOTP(%s at %d) rejected the code", test.code, test.unix)
+			continue
+		}
+		if want := test.unix / totpPeriod; step != want {
+			t.Errorf("ValidateTOTP(%s at %d) = step %d, want %d", test.code, test.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	key, _ := base32NoPadding.DecodeString(rfc6238Secret)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		step   int64
+		secret string
+		ok     bool
+	}{
+		{"current step", current, rfc6238Secret, true},
+		{"previous step", current - 1, rfc6238Secret, true},
+		{"next step", current + 1, rfc6238Secret, true},
+		{"two steps ago", current - 2, rfc6238Secret, false},
+		{"two steps ahead", current + 2, rfc6238Secret, false},
+		{"lower case secret", current, strings.ToLower(rfc6238Secret), true},
+		{"other secret", current, "JBSWY3DPEHPK3PXP", false},
+		{"invalid secret", current, "not base32!", false},
+	}
+	for _, test := range tests {
+		step, ok := ValidateTOTP(test.secret, hotp(key, test.step), now)
+		if ok != test.ok {
+			t.Errorf("%s: ValidateTOTP = %v, want %v", test.name, ok, test.ok)
+		}
+		// The step lets callers refuse a code they accepted before
+		if ok && step != test.step {
+			t.Errorf("%s: ValidateTOTP = step %d, want %d", test.name, step, test.step)
+		}
+	}
+
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(59, 0)); ok {
+			t.Errorf("ValidateTOTP(%q) accepted a malformed code", code)
+		}
+	}
+}
+
+func TestEncryptSecret(t *testing.T) {
+	if err := setMFAKey([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := EncryptSecret(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(encrypted, rfc6238Secret) {
+		t.Fatal("EncryptSecret returned the plaintext")
+	}
+	if again, _ := EncryptSecret(rfc6238Secret); again == encrypted {
+		t.Error("EncryptSecret reused a nonce")
+	}
+	if decrypted, err := DecryptSecret(encrypted); err != nil || decrypted != rfc6238Secret {
+		t.Errorf("DecryptSecret = %q, %v, want %q", decrypted, err, rfc6238Secret)
+	}
+
+	// The key is derived, not the SHA-256 of the secret it used to be
+	legacy := sha256.Sum256([]byte("0123456789abcdef0123456789abcdef"))
+	if string(mfaKey) == string(legacy[:]) {
+		t.Error("the key isn't derived with HKDF")
+	}
+	legacyEncrypted := sealWith(t, legacy[:], rfc6238Secret)
+	if decrypted, err := DecryptSecret(legacyEncrypted); err != nil || decrypted != rfc6238Secret {
+		t.Errorf("DecryptSecret(legacy) = %q, %v, want %q", decrypted, err, rfc6238Secret)
+	}
+
+	otherKey := sha256.Sum256([]byte("another key"))
+	for name, ciphertext := range map[string]string{
+		"not base64":    "!!!",
+		"too short":     base64.StdEncoding.EncodeToString([]byte("short")),
+		"tampered":      encrypted[:len(encrypted)-4] + "AAAA",
+		"other key":     sealWith(t, otherKey[:], rfc6238Secret),
+		"empty payload": "",
+	} {
+		if _, err := DecryptSecret(ciphertext); err == nil {
+			t.Errorf("DecryptSecret(%s) succeeded", name)
+		}
+	}
+}
+
+func TestEncryptSecretWithoutKey(t *testing.T) {
+	saved, savedLegacy := mfaKey, legacyMFAKey
+	defer func() { mfaKey, legacyMFAKey = saved, savedLegacy }()
+	mfaKey, legacyMFAKey = nil, nil
+
+	if _, err := EncryptSecret(rfc6238Secret); err == nil {
+		t.Error("EncryptSecret worked without MFA_ENCRYPTION_KEY")
+	}
+}
+
+func sealWith(t *testing.T, key []byte, plaintext string) string {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil))
+}
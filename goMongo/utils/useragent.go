@@ -0,0 +1,57 @@
+package utils
+
+import "strings"
+
+// User agent fragments, checked in order since most browsers claim to be
+// several others too
+var (
+	browserSignatures = []struct{ fragment, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+		{"okhttp/", "Android app"},
+		{"Go-http-client/", "Go client"},
+	}
+	osSignatures = []struct{ fragment, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DescribeUserAgent turns a User-Agent header into a short description of
+// the device such as "Firefox on Windows", for listing sessions.
+func DescribeUserAgent(userAgent string) string {
+	browser, os := "", ""
+	for _, signature := range browserSignatures {
+		if strings.Contains(userAgent, signature.fragment) {
+			browser = signature.name
+			break
+		}
+	}
+	for _, signature := range osSignatures {
+		if strings.Contains(userAgent, signature.fragment) {
+			os = signature.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	return "Unknown device"
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FieldError is one reason a request was rejected: the field, the rule it
+// broke and a message for people.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// RegisterValidators adds our rules to a validator, for use in binding tags:
+//
+//	objectid  the string is a MongoDB ObjectID in hex
+//	future    the time lies in the future
+//	notblank  the string has something besides whitespace
+//
+// Field names in errors are taken from the json, uri or form tag.
+func RegisterValidators(v *validator.Validate) error {
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "uri", "form"} {
+			name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+
+	rules := map[string]validator.Func{
+		"objectid": func(fl validator.FieldLevel) bool {
+			return primitive.IsValidObjectID(fl.Field().String())
+		},
+		"future": func(fl validator.FieldLevel) bool {
+			t, ok := fl.Field().Interface().(time.Time)
+			return ok && t.After(time.Now())
+		},
+		"notblank": func(fl validator.FieldLevel) bool {
+			return strings.TrimSpace(fl.Field().String()) != ""
+		},
+	}
+	for tag, rule := range rules {
+		if err := v.RegisterValidation(tag, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidationErrors turns an error from binding a request into field errors.
+// Errors that aren't about a single field, such as malformed JSON, get an
+// empty field.
+func ValidationErrors(err error) []FieldError {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var timeErr *time.ParseError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		fieldErrs := make([]FieldError, len(validationErrs))
+		for i, e := range validationErrs {
+			fieldErrs[i] = FieldError{Field: fieldPath(e), Rule: e.Tag(), Message: validationMessage(e)}
+		}
+		return fieldErrs
+	case errors.As(err, &typeErr):
+		return []FieldError{{Field: typeErr.Field, Rule: "type", Message: fmt.Sprintf("%s must be a %s", typeErr.Field, jsonTypeName(typeErr.Type))}}
+	case errors.As(err, &timeErr):
+		return []FieldError{{Rule: "type", Message: fmt.Sprintf("%q is not an RFC 3339 time such as 2006-01-02T15:04:05Z", timeErr.Value)}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return []FieldError{{Rule: "json", Message: "Request body is not valid JSON"}}
+	case errors.Is(err, io.EOF):
+		return []FieldError{{Rule: "required", Message: "Request body is required"}}
+	}
+	return []FieldError{{Rule: "invalid", Message: err.Error()}}
+}
+
+// fieldPath is the path of a field from the top of the request, such as
+// coordinates.lat, without the name of the Go type.
+func fieldPath(e validator.FieldError) string {
+	_, path, found := strings.Cut(e.Namespace(), ".")
+	if !found {
+		return e.Field()
+	}
+	return path
+}
+
+func validationMessage(e validator.FieldError) string {
+	field := e.Field()
+	switch e.Tag() {
+	case "required":
+		return field + " is required"
+	case "notblank":
+		return field + " must not be blank"
+	case "email":
+		return field + " must be a valid email address"
+	case "objectid":
+		return field + " must be a valid ID"
+	case "future":
+		return field + " must be in the future"
+	case "oneof":
+		return field + " must be one of " + strings.ReplaceAll(e.Param(), " ", ", ")
+	case "gtfield":
+		return field + " must be after " + e.Param()
+	case "min", "max", "len":
+		bound := map[string]string{"min": "at least", "max": "at most", "len": "exactly"}[e.Tag()]
+		switch e.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("%s must be %s %s characters long", field, bound, e.Param())
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return fmt.Sprintf("%s must have %s %s items", field, bound, e.Param())
+		}
+		return fmt.Sprintf("%s must be %s %s", field, bound, e.Param())
+	}
+	return fmt.Sprintf("%s failed the %s rule", field, e.Tag())
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "whole number"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return t.String()
+}